@@ -0,0 +1,470 @@
+package coco
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	defaultBufferMemoryLimit    int64 = 1 << 20
+	defaultDecompressionMaxSize int64 = 10 << 20
+
+	// maxFormSize matches the limit net/http applies to URL encoded bodies.
+	maxFormSize int64 = 10 << 20
+)
+
+// BufferOptions configures how request bodies are buffered.
+type BufferOptions struct {
+	// MemoryLimit is the number of bytes kept in memory before the body is
+	// spilled to a temporary file.
+	// Defaults to 1MB.
+	MemoryLimit int64
+
+	// MaxSize is the largest body accepted, in bytes. Larger bodies are
+	// rejected with 413 Request Entity Too Large.
+	// Defaults to 0, no limit.
+	MaxSize int64
+
+	// TempDir is the directory spilled bodies are written to.
+	// Defaults to os.TempDir().
+	TempDir string
+}
+
+// bodyBuffer holds a fully read request body, either in memory or in a
+// temporary file once it grows beyond the memory limit.
+type bodyBuffer struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+func (b *bodyBuffer) reader() io.ReadCloser {
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+	}
+	return io.NopCloser(bytes.NewReader(b.mem))
+}
+
+func (b *bodyBuffer) release() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	_ = b.file.Close()
+	b.file = nil
+	return os.Remove(name)
+}
+
+// BufferBody returns a middleware that buffers the request body so that it
+// can be read more than once by later handlers.
+func BufferBody(options *BufferOptions) Handler {
+	return func(res Response, req *Request, next NextFunc) {
+		if err := req.Body.Buffer(options); err != nil {
+			code := http.StatusBadRequest
+			if e, ok := err.(Error); ok {
+				code = e.Code
+			}
+			res.Status(code).Send(err.Error())
+			return
+		}
+		next(res, req)
+	}
+}
+
+// Buffer reads the request body into memory, spilling to a temporary file
+// past the memory limit, so that the body readers can be called repeatedly.
+// Calling Buffer on an already buffered body is a no-op.
+func (body *Body) Buffer(options *BufferOptions) error {
+	if body.buf != nil {
+		return nil
+	}
+	if options == nil {
+		options = &BufferOptions{}
+	}
+
+	limit := options.MemoryLimit
+	if limit <= 0 {
+		limit = defaultBufferMemoryLimit
+	}
+
+	buf := &bodyBuffer{}
+	if body.req.Body == nil {
+		body.buf = buf
+		body.req.Body = buf.reader()
+		return nil
+	}
+
+	src := body.req.Body
+	if options.MaxSize > 0 {
+		src = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(body.req.Body, options.MaxSize+1), body.req.Body}
+	}
+	defer body.req.Body.Close()
+
+	var mem bytes.Buffer
+	n, err := io.Copy(&mem, io.LimitReader(src, limit+1))
+	if err != nil {
+		return Error{http.StatusBadRequest, "Error reading request body: " + err.Error()}
+	}
+
+	if n <= limit {
+		buf.mem = mem.Bytes()
+		buf.size = n
+	} else {
+		file, err := os.CreateTemp(options.TempDir, "coco-body-*")
+		if err != nil {
+			return Error{http.StatusInternalServerError, "Error creating body buffer: " + err.Error()}
+		}
+		buf.file = file
+
+		written, err := io.Copy(file, io.MultiReader(&mem, src))
+		if err != nil {
+			_ = buf.release()
+			return Error{http.StatusBadRequest, "Error reading request body: " + err.Error()}
+		}
+		buf.size = written
+	}
+
+	if options.MaxSize > 0 && buf.size > options.MaxSize {
+		_ = buf.release()
+		return Error{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", options.MaxSize)}
+	}
+
+	body.buf = buf
+	body.req.Body = buf.reader()
+	return nil
+}
+
+// Buffered reports whether the body has been buffered and can be re-read.
+func (body *Body) Buffered() bool {
+	return body.buf != nil
+}
+
+// Raw returns the request body bytes exactly as they were received, which is
+// what signature verification and audit logging need. Unless the body is
+// buffered it can only be read once.
+func (body *Body) Raw() ([]byte, error) {
+	rc := body.open()
+	if rc == nil {
+		return nil, fmt.Errorf("request body is nil")
+	}
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+
+	if err := rc.Close(); err != nil {
+		return nil, fmt.Errorf("error closing request body: %w", err)
+	}
+
+	return b, nil
+}
+
+// open returns a reader positioned at the start of the body. When the body is
+// buffered, a fresh reader is also installed on the underlying request so
+// that net/http helpers such as ParseForm see the full body again.
+func (body *Body) open() io.ReadCloser {
+	if body.buf != nil {
+		body.req.Body = body.buf.reader()
+	}
+	return body.req.Body
+}
+
+// reader returns the body as the readers should see it: starting from the
+// raw bytes, undoing any Content-Encoding when decompression is enabled and
+// transcoding the Content-Type charset to UTF-8.
+func (body *Body) reader() (io.ReadCloser, error) {
+	rc := body.open()
+	if rc == nil {
+		return nil, nil
+	}
+
+	var r io.Reader = rc
+	var err error
+	if body.decompress != nil {
+		r, err = decompressBody(r, body.req.Header.Get("Content-Encoding"), body.decompress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r, err = decodeCharset(r, body.req.Header.Get("Content-Type"), body.strictCharset())
+	if err != nil {
+		return nil, err
+	}
+
+	if r == io.Reader(rc) {
+		return rc, nil
+	}
+
+	decoded := struct {
+		io.Reader
+		io.Closer
+	}{r, rc}
+	body.req.Body = decoded
+	return decoded, nil
+}
+
+// strictCharset reports whether the "strict charset" setting is enabled,
+// in which case bodies that are not valid UTF-8 after decoding are rejected.
+func (body *Body) strictCharset() bool {
+	strict, ok := body.setting("strict charset").(bool)
+	return ok && strict
+}
+
+// release removes any temporary file backing a buffered body.
+func (body *Body) release() {
+	if body.buf != nil {
+		_ = body.buf.release()
+	}
+}
+
+// DecompressOptions configures request body decompression.
+type DecompressOptions struct {
+	// MaxSize is the largest decompressed body accepted, in bytes, guarding
+	// against decompression bombs. Larger bodies fail with 413 Request Entity
+	// Too Large.
+	// Defaults to 10MB.
+	MaxSize int64
+}
+
+// Decompress returns a middleware that makes the body readers transparently
+// decode gzip and deflate request bodies. Requests with any other
+// Content-Encoding are rejected with 415 Unsupported Media Type.
+func Decompress(options *DecompressOptions) Handler {
+	if options == nil {
+		options = &DecompressOptions{}
+	}
+	return func(res Response, req *Request, next NextFunc) {
+		for _, coding := range parseContentEncoding(req.Get("Content-Encoding")) {
+			if !isSupportedEncoding(coding) {
+				res.Status(http.StatusUnsupportedMediaType).Send(fmt.Sprintf("Unsupported Content-Encoding: %s", coding))
+				return
+			}
+		}
+		req.Body.decompress = options
+		next(res, req)
+	}
+}
+
+func parseContentEncoding(header string) []string {
+	var codings []string
+	for _, part := range strings.Split(header, ",") {
+		coding := strings.ToLower(strings.TrimSpace(part))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+func isSupportedEncoding(coding string) bool {
+	switch coding {
+	case "gzip", "x-gzip", "deflate":
+		return true
+	}
+	return false
+}
+
+// decompressBody wraps r with decoders for every coding listed in
+// Content-Encoding, undoing them in the reverse order they were applied.
+func decompressBody(r io.Reader, header string, options *DecompressOptions) (io.Reader, error) {
+	codings := parseContentEncoding(header)
+	if len(codings) == 0 {
+		return r, nil
+	}
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, Error{http.StatusBadRequest, "Invalid gzip body: " + err.Error()}
+			}
+			r = zr
+		case "deflate":
+			r = newDeflateReader(r)
+		default:
+			return nil, Error{http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported Content-Encoding: %s", codings[i])}
+		}
+	}
+
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultDecompressionMaxSize
+	}
+
+	return &cappedReader{r: r, max: maxSize}, nil
+}
+
+// newDeflateReader reads "deflate" bodies, which are meant to be zlib
+// wrapped but are sent as raw DEFLATE streams by some clients.
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(br)
+}
+
+// cappedReader fails once more than max bytes have been read.
+type cappedReader struct {
+	r    io.Reader
+	read int64
+	max  int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.read > c.max {
+		return 0, c.tooLarge()
+	}
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return n, c.tooLarge()
+	}
+	return n, err
+}
+
+func (c *cappedReader) tooLarge() error {
+	return Error{http.StatusRequestEntityTooLarge, fmt.Sprintf("Decompressed body exceeds %d bytes", c.max)}
+}
+
+// decodeCharset transcodes r from the charset named in the Content-Type
+// header to UTF-8. Bodies without a charset, or already in UTF-8, are passed
+// through untouched unless strict is set, in which case invalid UTF-8 makes
+// the read fail with 400 Bad Request.
+//
+// URL encoded bodies are not transcoded, as their charset applies to the
+// percent-decoded keys and values: see decodeFormCharset.
+func decodeCharset(r io.Reader, contentType string, strict bool) (io.Reader, error) {
+	enc, err := charsetEncoding(contentType)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if enc != nil && mediaType != "application/x-www-form-urlencoded" {
+		r = transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder()))
+	}
+
+	if strict {
+		r = &utf8Reader{r: transform.NewReader(r, encoding.UTF8Validator)}
+	}
+	return r, nil
+}
+
+// charsetEncoding returns the encoding named by the charset parameter of
+// contentType, or nil when there is none or it is UTF-8. Unknown charsets
+// are reported with 415 Unsupported Media Type.
+func charsetEncoding(contentType string) (encoding.Encoding, error) {
+	charset := ""
+	if contentType != "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			charset = strings.ToLower(strings.TrimSpace(params["charset"]))
+		}
+	}
+
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii":
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, Error{http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported charset: %s", charset)}
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// readForm reads and parses a URL encoded body, failing with 413 Request
+// Entity Too Large past maxFormSize.
+func readForm(r io.Reader) (url.Values, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxFormSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxFormSize {
+		return nil, Error{http.StatusRequestEntityTooLarge, fmt.Sprintf("Form body exceeds %d bytes", maxFormSize)}
+	}
+	return url.ParseQuery(string(b))
+}
+
+// decodeFormCharset transcodes the keys and values of a parsed URL encoded
+// body from the charset named in contentType to UTF-8. Browsers percent
+// encode form fields in the page's charset, so this has to happen after
+// unescaping. With strict set, fields that are not valid UTF-8 afterwards
+// are rejected with 400 Bad Request.
+func decodeFormCharset(values url.Values, contentType string, strict bool) (url.Values, error) {
+	enc, err := charsetEncoding(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil && !strict {
+		return values, nil
+	}
+
+	decode := func(s string) (string, error) {
+		if enc != nil {
+			if s, err = enc.NewDecoder().String(s); err != nil {
+				return "", Error{http.StatusBadRequest, "Error decoding form data: " + err.Error()}
+			}
+		}
+		if strict && !utf8.ValidString(s) {
+			return "", Error{http.StatusBadRequest, "Request body is not valid UTF-8"}
+		}
+		return s, nil
+	}
+
+	decoded := make(url.Values, len(values))
+	for key, vs := range values {
+		k, err := decode(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vs {
+			v, err := decode(v)
+			if err != nil {
+				return nil, err
+			}
+			decoded[k] = append(decoded[k], v)
+		}
+	}
+	return decoded, nil
+}
+
+// utf8Reader reports invalid UTF-8 as a request Error.
+type utf8Reader struct {
+	r io.Reader
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err == encoding.ErrInvalidUTF8 {
+		err = Error{http.StatusBadRequest, "Request body is not valid UTF-8"}
+	}
+	return n, err
+}
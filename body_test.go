@@ -0,0 +1,377 @@
+package coco
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBody_Buffer(t *testing.T) {
+	t.Run("it should allow the body to be read multiple times", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"key": "value"}`))
+		req.Header.Set("Content-Type", "application/json")
+		body := &Body{req: req}
+
+		assert.NoError(t, body.Buffer(nil))
+		assert.True(t, body.Buffered())
+
+		raw, err := body.Raw()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"key": "value"}`, string(raw))
+
+		var data map[string]string
+		assert.NoError(t, body.JSON(&data))
+		assert.Equal(t, "value", data["key"])
+
+		text, err := body.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"key": "value"}`, text)
+	})
+
+	t.Run("it should spill large bodies to a temporary file", func(t *testing.T) {
+		payload := strings.Repeat("a", 64)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(payload))
+		body := &Body{req: req}
+
+		assert.NoError(t, body.Buffer(&BufferOptions{MemoryLimit: 16, TempDir: t.TempDir()}))
+		if body.buf.file == nil {
+			t.Fatal("Expected body to be spilled to a temporary file")
+		}
+		name := body.buf.file.Name()
+
+		for i := 0; i < 2; i++ {
+			text, err := body.Text()
+			assert.NoError(t, err)
+			assert.Equal(t, payload, text)
+		}
+
+		body.release()
+		_, err := os.Stat(name)
+		assert.True(t, os.IsNotExist(err), "Expected temporary file to be removed")
+	})
+
+	t.Run("it should reject bodies larger than MaxSize", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 32)))
+		body := &Body{req: req}
+
+		err := body.Buffer(&BufferOptions{MemoryLimit: 8, MaxSize: 16, TempDir: t.TempDir()})
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected Error with StatusRequestEntityTooLarge, got %v", err)
+		}
+		assert.False(t, body.Buffered())
+	})
+
+	t.Run("it should re-read form data after buffering", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("key=value"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		body := &Body{req: req}
+
+		assert.NoError(t, body.Buffer(nil))
+
+		data, err := body.FormData()
+		assert.NoError(t, err)
+		assert.Equal(t, "value", data["key"][0])
+
+		raw, err := body.Raw()
+		assert.NoError(t, err)
+		assert.Equal(t, "key=value", string(raw))
+	})
+}
+
+func TestBody_Raw(t *testing.T) {
+	body := &Body{
+		req: &http.Request{Body: io.NopCloser(bytes.NewBufferString("raw"))},
+	}
+
+	raw, err := body.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, "raw", string(raw))
+}
+
+func TestBufferBody(t *testing.T) {
+	secret := []byte("secret")
+	payload := `{"event": "push"}`
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	app := NewApp()
+	app.Use(BufferBody(&BufferOptions{MaxSize: 1024}))
+	app.Use(func(res Response, req *Request, next NextFunc) {
+		raw, err := req.Body.Raw()
+		if err != nil {
+			res.Status(http.StatusBadRequest).Send(err.Error())
+			return
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(raw)
+		if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(req.Get("X-Signature"))) {
+			res.SendStatus(http.StatusUnauthorized)
+			return
+		}
+		next(res, req)
+	})
+	app.Post("/hook", func(res Response, req *Request, next NextFunc) {
+		var data map[string]string
+		if err := req.Body.JSON(&data); err != nil {
+			res.Status(http.StatusBadRequest).Send(err.Error())
+			return
+		}
+		res.Send(data["event"])
+	})
+
+	t.Run("it should let middleware and handler both read the body", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/hook", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Signature", signature)
+		w := httptest.NewRecorder()
+
+		app.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "push", w.Body.String())
+	})
+
+	t.Run("it should respond 413 for oversized bodies", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/hook", strings.NewReader(strings.Repeat("a", 2048)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		app.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
+
+func gzipString(t *testing.T, s string) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatalf("Error compressing payload: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Error compressing payload: %v", err)
+	}
+	return &buf
+}
+
+func TestBody_Decompress(t *testing.T) {
+	t.Run("it should decode gzip JSON bodies", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", gzipString(t, `{"key": "value"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		body := &Body{req: req, decompress: &DecompressOptions{}}
+
+		var data map[string]string
+		assert.NoError(t, body.JSON(&data))
+		assert.Equal(t, "value", data["key"])
+	})
+
+	t.Run("it should decode deflate form bodies", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write([]byte("key=value"))
+		zw.Close()
+
+		req := httptest.NewRequest("POST", "/", &buf)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Content-Encoding", "deflate")
+		body := &Body{req: req, decompress: &DecompressOptions{}}
+
+		data, err := body.FormData()
+		assert.NoError(t, err)
+		assert.Equal(t, "value", data["key"][0])
+	})
+
+	t.Run("it should keep the raw bytes of buffered compressed bodies", func(t *testing.T) {
+		compressed := gzipString(t, "hello").Bytes()
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed))
+		req.Header.Set("Content-Encoding", "gzip")
+		body := &Body{req: req, decompress: &DecompressOptions{}}
+		assert.NoError(t, body.Buffer(nil))
+
+		text, err := body.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", text)
+
+		raw, err := body.Raw()
+		assert.NoError(t, err)
+		assert.Equal(t, compressed, raw)
+	})
+
+	t.Run("it should cap the decompressed size", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", gzipString(t, `"`+strings.Repeat("a", 4096)+`"`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		body := &Body{req: req, decompress: &DecompressOptions{MaxSize: 1024}}
+
+		var data string
+		err := body.JSON(&data)
+		var jsonErr JSONError
+		if !errors.As(err, &jsonErr) || jsonErr.Status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected JSONError with StatusRequestEntityTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("it should leave bodies untouched when not enabled", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("plain"))
+		req.Header.Set("Content-Encoding", "gzip")
+		body := &Body{req: req}
+
+		text, err := body.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, "plain", text)
+	})
+}
+
+func TestDecompress(t *testing.T) {
+	app := NewApp()
+	api := app.NewRouter("api")
+	api.Use(Decompress(nil))
+	api.Post("/echo", func(res Response, req *Request, next NextFunc) {
+		text, err := req.Body.Text()
+		if err != nil {
+			res.Status(http.StatusBadRequest).Send(err.Error())
+			return
+		}
+		res.Send(text)
+	})
+
+	t.Run("it should decompress bodies on routers that opt in", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/echo", gzipString(t, "hello"))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		app.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "hello", w.Body.String())
+	})
+
+	t.Run("it should respond 415 for unsupported encodings", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/echo", strings.NewReader("hello"))
+		req.Header.Set("Content-Encoding", "br")
+		w := httptest.NewRecorder()
+
+		app.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestBody_Charset(t *testing.T) {
+	t.Run("it should decode ISO-8859-1 text", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte{'c', 'a', 'f', 0xe9}))
+		req.Header.Set("Content-Type", "text/plain; charset=ISO-8859-1")
+		body := &Body{req: req}
+
+		text, err := body.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, "café", text)
+	})
+
+	t.Run("it should decode percent-encoded Windows-1252 form data", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/?page=1", strings.NewReader("name=caf%E9&pri%E8re=5%80"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=windows-1252")
+		body := &Body{req: req}
+
+		data, err := body.FormData()
+		assert.NoError(t, err)
+		assert.Equal(t, "café", data["name"][0])
+		assert.Equal(t, "5€", data["prière"][0])
+		assert.Equal(t, "1", data["page"][0])
+		assert.Equal(t, "café", req.PostForm.Get("name"))
+	})
+
+	t.Run("it should decode percent-encoded Windows-1252 form data into structs", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("name=caf%E9"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=windows-1252")
+		body := &Body{req: req, app: NewApp()}
+
+		var data struct {
+			Name string `form:"name"`
+		}
+		assert.NoError(t, body.Decode(&data))
+		assert.Equal(t, "café", data.Name)
+	})
+
+	t.Run("it should reject percent-encoded invalid UTF-8 form data in strict mode", func(t *testing.T) {
+		app := NewApp()
+		app.SetSetting("strict charset", true)
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader("name=caf%E9"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		body := &Body{req: req, app: app}
+
+		_, err := body.FormData()
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusBadRequest {
+			t.Fatalf("Expected Error with StatusBadRequest, got %v", err)
+		}
+	})
+
+	t.Run("it should decode UTF-16 JSON with a byte order mark", func(t *testing.T) {
+		payload := []byte{0xfe, 0xff}
+		for _, r := range `{"key":"value"}` {
+			payload = append(payload, 0, byte(r))
+		}
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json; charset=utf-16")
+		body := &Body{req: req}
+
+		var data map[string]string
+		assert.NoError(t, body.JSON(&data))
+		assert.Equal(t, "value", data["key"])
+	})
+
+	t.Run("it should reject unknown charsets", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("text"))
+		req.Header.Set("Content-Type", "text/plain; charset=klingon")
+		body := &Body{req: req}
+
+		_, err := body.Text()
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("Expected Error with StatusUnsupportedMediaType, got %v", err)
+		}
+	})
+
+	t.Run("it should reject invalid UTF-8 in strict mode", func(t *testing.T) {
+		app := NewApp()
+		app.SetSetting("strict charset", true)
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte{'o', 'k', 0xff}))
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		body := &Body{req: req, app: app}
+
+		_, err := body.Text()
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusBadRequest {
+			t.Fatalf("Expected Error with StatusBadRequest, got %v", err)
+		}
+	})
+
+	t.Run("it should pass invalid UTF-8 through when not strict", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte{'o', 'k', 0xff}))
+		req.Header.Set("Content-Type", "text/plain")
+		body := &Body{req: req, app: NewApp()}
+
+		text, err := body.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, "ok\xff", text)
+	})
+}
@@ -2,6 +2,7 @@ package coco
 
 import (
 	coreCtx "context"
+	"crypto/cipher"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -32,6 +33,12 @@ type App struct {
 	settings      map[string]interface{}
 	once          sync.Once
 	settingsMutex sync.RWMutex
+	encoders      []registeredEncoder
+	decoders      []registeredDecoder
+	codecsMutex   sync.RWMutex
+	cookieSecrets []string
+	cookieKeys    []cipher.AEAD
+	trustProxy    TrustFunc
 }
 
 // Settings returns the settings instance for the App.
@@ -62,6 +69,8 @@ func NewApp() (app *App) {
 			http.Error(w, "Handler not configured", http.StatusInternalServerError)
 		}),
 		settings: defaultSettings(),
+		encoders: defaultEncoders(),
+		decoders: defaultDecoders(),
 	}
 
 	app.route = app.newRoute(app.basePath, true, nil)
@@ -106,37 +115,95 @@ func (a *App) Close() error {
 
 // configureRoutes method attaches the routes to their relevant handlers and middleware
 func (a *App) configureRoutes() {
-	a.traverseAndConfigure(a.route)
+	a.traverseAndConfigure(a.route, a.route.optionsPaths(make(map[string]bool)))
 }
 
-func (a *App) traverseAndConfigure(r *route) {
+func (a *App) traverseAndConfigure(r *route, optionsPaths map[string]bool) {
+	policy := r.corsPolicy()
+	var preflights []string
+	var methods map[string][]string
+	if policy != nil {
+		preflights, methods = r.preflightPaths(optionsPaths)
+	}
+
 	for _, path := range r.paths {
 		handlers := r.combineHandlers(path.handlers...)
-		r.hr.Handle(path.method, path.name, func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
-			request, err := newRequest(req, w, p, a)
-			if err != nil {
-				fmt.Printf("DEBUG: %v\n", err)
-			}
-			ctx := &context{
-				handlers:  handlers,
-				templates: r.app.templates,
-				req:       request,
-			}
-			response := Response{ww: wrapWriter(w), ctx: ctx}
-			execParamChain(ctx, p, r.paramHandlers)
-			ctx.next(response, request)
-		})
+		if policy != nil {
+			handlers = append([]Handler{policy.handler(methods[path.name])}, handlers...)
+		}
+		r.hr.Handle(path.method, path.name, a.dispatch(r, handlers, r.paramHandlers))
+	}
+	for _, name := range preflights {
+		r.hr.Handle(http.MethodOptions, name, a.dispatch(r, policy.preflightHandlers(methods[name]), nil))
 	}
 	for _, child := range r.children {
-		a.traverseAndConfigure(child)
+		a.traverseAndConfigure(child, optionsPaths)
+	}
+}
+
+// dispatch returns the httprouter handle running handlers for route r,
+// preceded by the param handlers matching the path parameters. Responses
+// start with X-Powered-By, when the "x-powered-by" setting is enabled, and
+// the router's default headers.
+func (a *App) dispatch(r *route, handlers []Handler, paramHandlers map[string]ParamHandler) httprouter.Handle {
+	headers := r.defaultHeaders()
+	return func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
+		ww := wrapWriter(w)
+		header := ww.Header()
+		if poweredBy, ok := lookupSetting(r, a, "x-powered-by").(bool); ok && poweredBy {
+			header.Set("X-Powered-By", "coco")
+		}
+		for key, values := range headers {
+			header[key] = append([]string(nil), values...)
+		}
+		request, err := newRequest(req, ww, p, a)
+		if err != nil {
+			fmt.Printf("DEBUG: %v\n", err)
+		}
+		ctx := &context{
+			handlers:  handlers,
+			templates: r.app.templates,
+			req:       request,
+			app:       a,
+			route:     r,
+		}
+		request.route = r
+		request.Body.route = r
+		response := Response{ww: ww, ctx: ctx}
+		defer request.Body.release()
+		defer request.closeStreams()
+		execParamChain(ctx, p, paramHandlers)
+		ctx.next(response, request)
 	}
 }
 
 // SetSetting sets a custom setting with a key and value.
+//
+// It panics if the "trust proxy" setting is given an invalid value, such as
+// a malformed CIDR range; see compileTrust for the accepted values.
 func (a *App) SetSetting(key string, value interface{}) {
+	var trust TrustFunc
+	if key == "trust proxy" {
+		var err error
+		if trust, err = compileTrust(value); err != nil {
+			panic("coco: " + err.Error())
+		}
+	}
+
 	a.settingsMutex.Lock()
 	defer a.settingsMutex.Unlock()
 	a.settings[key] = value
+	if key == "trust proxy" {
+		a.trustProxy = trust
+	}
+}
+
+// trust returns the compiled "trust proxy" setting, or nil if no proxy is
+// trusted.
+func (a *App) trust() TrustFunc {
+	a.settingsMutex.RLock()
+	defer a.settingsMutex.RUnlock()
+	return a.trustProxy
 }
 
 // GetSetting retrieves a custom setting by its key.
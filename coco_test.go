@@ -154,3 +154,89 @@ func TestApp_Settings(t *testing.T) {
 		t.Errorf("Expected 'x-powered-by' to be enabled")
 	}
 }
+
+func TestApp_XPoweredBy(t *testing.T) {
+	app := coco.NewApp()
+	quiet := app.NewRouter("/quiet")
+	quiet.SetSetting("x-powered-by", false)
+
+	handler := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	}
+	app.Get("/", handler)
+	quiet.Get("/", handler)
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Powered-By"); got != "coco" {
+		t.Errorf("Expected X-Powered-By to be 'coco', got '%s'", got)
+	}
+
+	resp, err = http.Get(srv.URL + "/quiet/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := resp.Header["X-Powered-By"]; ok {
+		t.Errorf("Expected no X-Powered-By header on a router with the setting disabled")
+	}
+
+	app.SetSetting("x-powered-by", false)
+	resp, err = http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := resp.Header["X-Powered-By"]; ok {
+		t.Errorf("Expected no X-Powered-By header once the setting is disabled")
+	}
+}
+
+func TestApp_DefaultHeaders(t *testing.T) {
+	app := coco.NewApp()
+	app.SetDefaultHeader("Server", "coco").SetDefaultHeader("X-Region", "eu")
+
+	api := app.NewRouter("/api")
+	api.SetDefaultHeader("Server", "coco-api").SetDefaultHeader("X-Region", "")
+
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	})
+	app.Get("/custom", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("Server", "custom")
+		res.Send("ok")
+	})
+	api.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	tests := []struct {
+		path, server, region string
+	}{
+		{"/", "coco", "eu"},
+		{"/custom", "custom", "eu"},
+		{"/api/", "coco-api", ""},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Server"); got != tt.server {
+			t.Errorf("%s: expected Server to be '%s', got '%s'", tt.path, tt.server, got)
+		}
+		if got := resp.Header.Get("X-Region"); got != tt.region {
+			t.Errorf("%s: expected X-Region to be '%s', got '%s'", tt.path, tt.region, got)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package coco
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultCompressMinSize = 1024
+
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"image/svg+xml",
+	"+json",
+	"+xml",
+}
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// Level is the gzip or deflate compression level, from
+	// gzip.BestSpeed to gzip.BestCompression.
+	// Defaults to gzip.DefaultCompression.
+	Level int
+
+	// MinSize is the smallest body, in bytes, that is compressed. Streamed
+	// responses are compressed from their first Flush whatever their size.
+	// Defaults to 1024.
+	MinSize int
+
+	// Types lists the compressible media types, as patterns such as
+	// "text/*" or "+json".
+	// Defaults to text, JSON, JavaScript, XML and SVG types.
+	Types []string
+
+	// Skip, when set, disables compression for the requests it returns true
+	// for.
+	Skip func(req *Request) bool
+}
+
+// Compress returns a Handler that compresses response bodies with gzip or
+// deflate, as negotiated by the Accept-Encoding header. Responses are left
+// alone when they are smaller than MinSize, of a media type not in Types,
+// already encoded, partial (206 or with Content-Range), marked
+// Cache-Control: no-transform, or have no body. Compressible responses get
+// Vary: Accept-Encoding whether or not they are compressed.
+//
+// Flush compresses and sends what has been written so far, so streamed
+// responses such as Response.SSE keep working.
+func Compress(options *CompressOptions) Handler {
+	opts := CompressOptions{Level: gzip.DefaultCompression}
+	if options != nil {
+		opts = *options
+		if opts.Level == 0 {
+			opts.Level = gzip.DefaultCompression
+		}
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = defaultCompressTypes
+	}
+
+	return func(res Response, req *Request, next NextFunc) {
+		if opts.Skip != nil && opts.Skip(req) {
+			next(res, req)
+			return
+		}
+
+		encoding := ""
+		if _, ok := req.r.Header["Accept-Encoding"]; ok {
+			encoding = req.AcceptsEncodings("gzip", "deflate", "identity")
+		}
+		if encoding == "identity" {
+			encoding = ""
+		}
+
+		ww := res.ww
+		cw := &compressWriter{
+			ResponseWriter: ww.ResponseWriter,
+			flusher:        ww.flusher,
+			options:        &opts,
+			encoding:       encoding,
+			head:           req.r.Method == http.MethodHead,
+		}
+		ww.ResponseWriter = cw
+		ww.flusher = cw
+		defer func() {
+			_ = cw.Close()
+			ww.ResponseWriter = cw.ResponseWriter
+			ww.flusher = cw.flusher
+		}()
+
+		next(res, req)
+	}
+}
+
+// compressWriter buffers the start of the body until it can decide whether
+// to compress it, then writes the headers and either compresses or passes
+// the body through.
+type compressWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+
+	options  *CompressOptions
+	encoding string
+	head     bool
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+	closed  bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	// Informational responses go straight through.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if code == http.StatusSwitchingProtocols {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.options.MinSize {
+			return len(b), nil
+		}
+		w.decide(true)
+		return len(b), w.writeBuffered()
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written so far, compressing it if the
+// response is compressible.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(true)
+		if err := w.writeBuffered(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+}
+
+// Close finishes the response: a body still buffered is below MinSize and
+// sent as is.
+func (w *compressWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if !w.decided {
+		if w.status == 0 {
+			return nil
+		}
+		w.decide(false)
+		return w.writeBuffered()
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+func (w *compressWriter) writeBuffered() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// decide sets the encoding headers and writes the status. large reports
+// whether the body reached MinSize or is being streamed.
+func (w *compressWriter) decide(large bool) {
+	w.decided = true
+	header := w.Header()
+
+	// Sniff the type now, as net/http would on the first write, so that
+	// untyped bodies can be matched against Types.
+	if _, ok := header["Content-Type"]; !ok && len(w.buf) > 0 && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if w.compressible(header) {
+		vary(header, "Accept-Encoding")
+		if large && w.encoding != "" {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				header.Set("ETag", "W/"+etag)
+			}
+			w.encoder = w.newEncoder()
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) compressible(header http.Header) bool {
+	switch {
+	case w.head,
+		w.status < 200,
+		w.status == http.StatusNoContent,
+		w.status == http.StatusNotModified,
+		w.status == http.StatusPartialContent,
+		header.Get("Content-Encoding") != "",
+		header.Get("Content-Range") != "",
+		strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform"):
+		return false
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(header.Get("Content-Type"), ";")[0])
+	for _, pattern := range w.options.Types {
+		if typeMatches(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) newEncoder() io.WriteCloser {
+	if w.encoding == "deflate" {
+		zw, err := zlib.NewWriterLevel(w.ResponseWriter, w.options.Level)
+		if err != nil {
+			zw = zlib.NewWriter(w.ResponseWriter)
+		}
+		return zw
+	}
+	gw, err := gzip.NewWriterLevel(w.ResponseWriter, w.options.Level)
+	if err != nil {
+		gw = gzip.NewWriter(w.ResponseWriter)
+	}
+	return gw
+}
+
+// vary adds field to the Vary header unless it is already listed.
+func vary(header http.Header, field string) {
+	for _, f := range splitHeader(header.Get("Vary")) {
+		if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, field) {
+			return
+		}
+	}
+	if existing := header.Get("Vary"); existing != "" {
+		field = existing + ", " + field
+	}
+	header.Set("Vary", field)
+}
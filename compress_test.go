@@ -0,0 +1,144 @@
+package coco_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func newCompressApp(options *coco.CompressOptions) *coco.App {
+	large := strings.Repeat("coco compresses well. ", 100)
+
+	app := coco.NewApp()
+	app.Use(coco.Compress(options))
+	app.Get("/large", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(large)
+	})
+	app.Head("/large", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(large)
+	})
+	app.Get("/small", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("tiny")
+	})
+	app.Get("/png", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("Content-Type", "image/png")
+		res.Send(large)
+	})
+	app.Get("/encoded", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("Content-Encoding", "br")
+		res.Send(large)
+	})
+	app.Get("/range", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("Content-Range", "bytes 0-1999/4000")
+		res.Status(http.StatusPartialContent).Send(large[:2000])
+	})
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		stream := res.SSE()
+		stream.Send("greeting", "", "hello")
+		<-req.Context().Done()
+	})
+	return app
+}
+
+func TestCompress(t *testing.T) {
+	app := newCompressApp(nil)
+	large := strings.Repeat("coco compresses well. ", 100)
+
+	resp, body := doRequest(t, app, http.MethodGet, "/large", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Empty(t, resp.Header.Get("Content-Length"))
+	assert.True(t, strings.HasPrefix(resp.Header.Get("ETag"), "W/"))
+	gr, err := gzip.NewReader(strings.NewReader(body))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(gr)
+	assert.NoError(t, err)
+	assert.Equal(t, large, string(decoded))
+
+	resp, body = doRequest(t, app, http.MethodGet, "/large", map[string]string{"Accept-Encoding": "deflate, gzip;q=0.5"})
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	zr, err := zlib.NewReader(strings.NewReader(body))
+	assert.NoError(t, err)
+	decoded, err = io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, large, string(decoded))
+}
+
+func TestCompress_Skipped(t *testing.T) {
+	app := newCompressApp(nil)
+	gzipOnly := map[string]string{"Accept-Encoding": "gzip"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		vary    string
+	}{
+		{"no Accept-Encoding", http.MethodGet, "/large", nil, "Accept-Encoding"},
+		{"identity only", http.MethodGet, "/large", map[string]string{"Accept-Encoding": "identity"}, "Accept-Encoding"},
+		{"below MinSize", http.MethodGet, "/small", gzipOnly, "Accept-Encoding"},
+		{"HEAD", http.MethodHead, "/large", gzipOnly, ""},
+		{"incompressible type", http.MethodGet, "/png", gzipOnly, ""},
+		{"already encoded", http.MethodGet, "/encoded", gzipOnly, ""},
+		{"partial content", http.MethodGet, "/range", gzipOnly, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := doRequest(t, app, tt.method, tt.path, tt.headers)
+			assert.NotEqual(t, "gzip", resp.Header.Get("Content-Encoding"))
+			assert.Equal(t, tt.vary, resp.Header.Get("Vary"))
+		})
+	}
+
+	_, body := doRequest(t, app, http.MethodGet, "/small", gzipOnly)
+	assert.Equal(t, "tiny", body)
+}
+
+func TestCompress_Options(t *testing.T) {
+	app := newCompressApp(&coco.CompressOptions{
+		MinSize: 1,
+		Types:   []string{"image/*"},
+		Skip: func(req *coco.Request) bool {
+			return req.Path == "/large"
+		},
+	})
+
+	resp, _ := doRequest(t, app, http.MethodGet, "/png", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	resp, _ = doRequest(t, app, http.MethodGet, "/small", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Empty(t, resp.Header.Get("Content-Encoding"), "text is no longer in Types")
+
+	resp, _ = doRequest(t, app, http.MethodGet, "/large", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.Header.Get("Vary"))
+}
+
+func TestCompress_SSE(t *testing.T) {
+	srv := httptest.NewServer(newCompressApp(nil))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	// The event is flushed through the compressor before the handler ends.
+	gr, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	line, err := bufio.NewReader(gr).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: greeting\n", line)
+}
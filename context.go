@@ -10,6 +10,7 @@ type context struct {
 	templates map[string]*template.Template
 	req       *Request
 	app       *App
+	route     *route
 }
 
 func (c *context) coco() *App {
@@ -0,0 +1,192 @@
+package coco
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetCookieSecrets sets the secrets used for signed cookies. The first
+// secret signs new cookies and all of them are tried when verifying, so a
+// secret can be rotated by putting the new one first and dropping the old
+// one once its cookies have expired.
+func (a *App) SetCookieSecrets(secrets ...string) {
+	a.settingsMutex.Lock()
+	defer a.settingsMutex.Unlock()
+	a.cookieSecrets = append([]string(nil), secrets...)
+}
+
+func (a *App) secrets() []string {
+	if a == nil {
+		return nil
+	}
+	a.settingsMutex.RLock()
+	defer a.settingsMutex.RUnlock()
+	return a.cookieSecrets
+}
+
+func signCookieValue(value, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(value))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)) + "." + value
+}
+
+// unsignCookieValue splits a signed cookie value into its value and
+// signature. ok is false if value is not in the signed format; valid
+// reports whether the signature matches one of secrets.
+func unsignCookieValue(value string, secrets []string) (unsigned string, ok, valid bool) {
+	encoded, unsigned, found := strings.Cut(value, ".")
+	if !found {
+		return "", false, false
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(signature) != sha256.Size {
+		return "", false, false
+	}
+
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write([]byte(unsigned))
+		if hmac.Equal(signature, mac.Sum(nil)) {
+			return unsigned, true, true
+		}
+	}
+	return "", true, false
+}
+
+// parseCookies splits the request cookies into plain and signed ones. With
+// secrets configured, cookies in the signed format are verified: valid ones
+// go to signed without their signature and tampered ones are dropped.
+func parseCookies(cookies []*http.Cookie, secrets []string) (plain, signed map[string]string) {
+	plain = make(map[string]string)
+	signed = make(map[string]string)
+	for _, cookie := range cookies {
+		if len(secrets) > 0 {
+			if value, ok, valid := unsignCookieValue(cookie.Value, secrets); ok {
+				if valid {
+					signed[cookie.Name] = value
+				}
+				continue
+			}
+		}
+		plain[cookie.Name] = cookie.Value
+	}
+	return plain, signed
+}
+
+// maxCookieSize is the cookie size browsers are required to support, per
+// RFC 6265, section 6.1.
+const maxCookieSize = 4096
+
+var (
+	// ErrCookieTooLarge is returned when a cookie would exceed 4KB.
+	ErrCookieTooLarge = errors.New("cookie exceeds 4096 bytes")
+
+	// ErrCookieInvalid is returned when an encrypted cookie cannot be
+	// decrypted with any of the App's cookie keys.
+	ErrCookieInvalid = errors.New("invalid encrypted cookie")
+
+	// ErrCookieExpired is returned when an encrypted cookie's embedded expiry
+	// has passed.
+	ErrCookieExpired = errors.New("encrypted cookie expired")
+
+	// ErrNoCookieKeys is returned when encrypted cookies are used before
+	// App.SetCookieKeys.
+	ErrNoCookieKeys = errors.New("encrypted cookies require App.SetCookieKeys")
+
+	// ErrNoCookieSecrets is returned when signed cookies are used before
+	// App.SetCookieSecrets.
+	ErrNoCookieSecrets = errors.New("signed cookies require App.SetCookieSecrets")
+)
+
+// SetCookieKeys sets the AES keys, 16, 24 or 32 bytes long, used for
+// encrypted cookies. The first key encrypts new cookies and all of them are
+// tried when decrypting, so keys can be rotated like cookie secrets.
+func (a *App) SetCookieKeys(keys ...[]byte) error {
+	aeads := make([]cipher.AEAD, 0, len(keys))
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		aeads = append(aeads, aead)
+	}
+
+	a.settingsMutex.Lock()
+	defer a.settingsMutex.Unlock()
+	a.cookieKeys = aeads
+	return nil
+}
+
+func (a *App) cookieAEADs() []cipher.AEAD {
+	if a == nil {
+		return nil
+	}
+	a.settingsMutex.RLock()
+	defer a.settingsMutex.RUnlock()
+	return a.cookieKeys
+}
+
+// encryptCookieValue seals the expiry and value with AES-GCM, using the
+// cookie name as additional data so values cannot be swapped between
+// cookies.
+func encryptCookieValue(aead cipher.AEAD, name, value string, expires time.Time) (string, error) {
+	plaintext := make([]byte, 8, 8+len(value))
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(plaintext, uint64(expires.Unix()))
+	}
+	plaintext = append(plaintext, value...)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func decryptCookieValue(aeads []cipher.AEAD, name, value string, now time.Time) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+
+	for _, aead := range aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+		if err != nil || len(plaintext) < 8 {
+			continue
+		}
+		if expires := int64(binary.BigEndian.Uint64(plaintext)); expires != 0 && now.Unix() >= expires {
+			return "", ErrCookieExpired
+		}
+		return string(plaintext[8:]), nil
+	}
+	return "", ErrCookieInvalid
+}
+
+// cookieExpiry returns when cookie expires, from MaxAge or Expires, or the
+// zero time for a session cookie.
+func cookieExpiry(cookie *http.Cookie, now time.Time) time.Time {
+	switch {
+	case cookie.MaxAge > 0:
+		return now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case cookie.MaxAge < 0:
+		return now
+	}
+	return cookie.Expires
+}
@@ -0,0 +1,136 @@
+package coco
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest_SignedCookies(t *testing.T) {
+	app := NewApp()
+	app.SetCookieSecrets("new", "old")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "plain", Value: "hello.world"})
+	r.AddCookie(&http.Cookie{Name: "current", Value: signCookieValue("a", "new")})
+	r.AddCookie(&http.Cookie{Name: "rotated", Value: signCookieValue("b", "old")})
+	r.AddCookie(&http.Cookie{Name: "retired", Value: signCookieValue("c", "ancient")})
+	r.AddCookie(&http.Cookie{Name: "tampered", Value: signCookieValue("d", "new") + "x"})
+
+	req, err := newRequest(r, httptest.NewRecorder(), httprouter.Params{}, app)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"current": "a", "rotated": "b"}, req.SignedCookies)
+	assert.Equal(t, map[string]string{"plain": "hello.world"}, req.Cookies)
+}
+
+func TestResponse_SignedCookie(t *testing.T) {
+	app := NewApp()
+	var setErr error
+	app.Get("/", func(res Response, req *Request, next NextFunc) {
+		setErr = res.SignedCookie(&http.Cookie{Name: "id", Value: "42"})
+	})
+
+	t.Run("it should fail without secrets", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.ErrorIs(t, setErr, ErrNoCookieSecrets)
+		assert.Empty(t, w.Result().Cookies())
+	})
+
+	t.Run("it should round-trip with the first secret", func(t *testing.T) {
+		app.SetCookieSecrets("new", "old")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		assert.NoError(t, setErr)
+		cookies := w.Result().Cookies()
+		if assert.Len(t, cookies, 1) {
+			value, ok, valid := unsignCookieValue(cookies[0].Value, []string{"new"})
+			assert.True(t, ok && valid)
+			assert.Equal(t, "42", value)
+		}
+	})
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 16)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	app := NewApp()
+	var setErr error
+	app.Get("/set", func(res Response, req *Request, next NextFunc) {
+		setErr = res.EncryptedCookie(&http.Cookie{Name: "state", Value: req.Query["v"], MaxAge: 60})
+	})
+
+	read := func(cookie *http.Cookie) (string, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		req, err := newRequest(r, httptest.NewRecorder(), httprouter.Params{}, app)
+		assert.NoError(t, err)
+		return req.EncryptedCookie(cookie.Name)
+	}
+
+	t.Run("it should require keys", func(t *testing.T) {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/set?v=x", nil))
+		assert.ErrorIs(t, setErr, ErrNoCookieKeys)
+		assert.Error(t, app.SetCookieKeys([]byte("short")))
+	})
+
+	assert.NoError(t, app.SetCookieKeys(oldKey))
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/set?v=private", nil))
+	assert.NoError(t, setErr)
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	sealed := cookies[0]
+	assert.NotContains(t, sealed.Value, "private")
+
+	t.Run("it should decrypt with rotated keys", func(t *testing.T) {
+		assert.NoError(t, app.SetCookieKeys(newKey, oldKey))
+		value, err := read(sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, "private", value)
+	})
+
+	t.Run("it should reject retired keys, other names and tampering", func(t *testing.T) {
+		assert.NoError(t, app.SetCookieKeys(newKey))
+		_, err := read(sealed)
+		assert.ErrorIs(t, err, ErrCookieInvalid)
+
+		assert.NoError(t, app.SetCookieKeys(oldKey))
+		_, err = read(&http.Cookie{Name: "other", Value: sealed.Value})
+		assert.ErrorIs(t, err, ErrCookieInvalid)
+
+		raw, _ := base64.RawURLEncoding.DecodeString(sealed.Value)
+		raw[len(raw)/2] ^= 1
+		_, err = read(&http.Cookie{Name: "state", Value: base64.RawURLEncoding.EncodeToString(raw)})
+		assert.ErrorIs(t, err, ErrCookieInvalid)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		req, _ := newRequest(r, httptest.NewRecorder(), httprouter.Params{}, app)
+		_, err = req.EncryptedCookie("state")
+		assert.ErrorIs(t, err, http.ErrNoCookie)
+	})
+
+	t.Run("it should enforce the embedded expiry", func(t *testing.T) {
+		value, err := encryptCookieValue(app.cookieAEADs()[0], "state", "stale", time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		_, err = read(&http.Cookie{Name: "state", Value: value})
+		assert.ErrorIs(t, err, ErrCookieExpired)
+	})
+
+	t.Run("it should enforce the 4KB limit", func(t *testing.T) {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/set?v="+strings.Repeat("x", 3500), nil))
+		assert.ErrorIs(t, setErr, ErrCookieTooLarge)
+	})
+}
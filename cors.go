@@ -0,0 +1,258 @@
+package coco
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete,
+}
+
+// CORSOptions configures cross-origin resource sharing.
+type CORSOptions struct {
+	// Origins lists the allowed origins. An entry is either an exact origin
+	// such as "https://example.com", a wildcard subdomain such as
+	// "https://*.example.com", which matches subdomains but not the domain
+	// itself, or "*" for any origin.
+	// Defaults to "*" when OriginPatterns and AllowOriginFunc are unset too.
+	Origins []string
+
+	// OriginPatterns are regular expressions matched against the whole
+	// Origin header.
+	OriginPatterns []*regexp.Regexp
+
+	// AllowOriginFunc decides on origins not matched by Origins or
+	// OriginPatterns.
+	AllowOriginFunc func(origin string, req *Request) bool
+
+	// Methods are the methods allowed in preflight responses. Defaults to
+	// the methods registered for the path with Route.CORS, and to GET, HEAD,
+	// PUT, PATCH, POST and DELETE otherwise.
+	Methods []string
+
+	// AllowedHeaders are the request headers allowed in preflight responses.
+	// Defaults to reflecting the Access-Control-Request-Headers header.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that scripts may read.
+	ExposedHeaders []string
+
+	// Credentials allows cookies and authorization headers. As browsers
+	// reject "*" with credentials, the request origin is sent instead.
+	Credentials bool
+
+	// MaxAge is how long preflight responses may be cached. Defaults to 0,
+	// which leaves it to the browser.
+	MaxAge time.Duration
+
+	// PreflightStatus is the status of successful preflight responses.
+	// Defaults to 204 No Content.
+	PreflightStatus int
+}
+
+// corsPolicy is a normalised CORSOptions.
+type corsPolicy struct {
+	options   CORSOptions
+	anyOrigin bool
+	exact     map[string]bool
+	wildcards []*url.URL
+}
+
+func newCORSPolicy(options *CORSOptions) *corsPolicy {
+	p := &corsPolicy{exact: make(map[string]bool)}
+	if options != nil {
+		p.options = *options
+	}
+	if p.options.PreflightStatus == 0 {
+		p.options.PreflightStatus = http.StatusNoContent
+	}
+
+	opts := &p.options
+	if len(opts.Origins) == 0 && len(opts.OriginPatterns) == 0 && opts.AllowOriginFunc == nil {
+		p.anyOrigin = true
+	}
+	for _, origin := range opts.Origins {
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			if u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1)); err == nil {
+				p.wildcards = append(p.wildcards, u)
+			}
+		default:
+			p.exact[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string, req *Request) bool {
+	if p.anyOrigin || p.exact[strings.ToLower(origin)] {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil {
+		for _, w := range p.wildcards {
+			if strings.EqualFold(u.Scheme, w.Scheme) && strings.HasSuffix(strings.ToLower(u.Host), "."+strings.ToLower(w.Host)) {
+				return true
+			}
+		}
+	}
+	for _, re := range p.options.OriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.options.AllowOriginFunc != nil && p.options.AllowOriginFunc(origin, req)
+}
+
+// handler returns the Handler applying the policy. Preflight requests are
+// answered, listing methods unless the options set them, and end the chain.
+func (p *corsPolicy) handler(methods []string) Handler {
+	opts := &p.options
+	if len(opts.Methods) > 0 {
+		methods = opts.Methods
+	}
+	allowMethods := strings.Join(methods, ", ")
+	exposeHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	allowHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	fixedOrigin := p.anyOrigin && !opts.Credentials
+
+	return func(res Response, req *Request, next NextFunc) {
+		origin := req.r.Header.Get("Origin")
+		preflight := req.r.Method == http.MethodOptions && req.r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Unless every origin gets the same answer, caches must key the
+		// response on Origin, including when no Origin was sent.
+		if !fixedOrigin {
+			res.Vary("Origin")
+		}
+
+		if origin == "" || !p.allowOrigin(origin, req) {
+			if preflight {
+				endPreflight(res, opts.PreflightStatus)
+				return
+			}
+			next(res, req)
+			return
+		}
+
+		if fixedOrigin {
+			res.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			res.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.Credentials {
+			res.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				res.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next(res, req)
+			return
+		}
+
+		res.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			res.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requested := req.r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			res.Vary("Access-Control-Request-Headers")
+			res.Set("Access-Control-Allow-Headers", requested)
+		}
+		if opts.MaxAge > 0 {
+			res.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+		}
+		endPreflight(res, opts.PreflightStatus)
+	}
+}
+
+func endPreflight(res Response, status int) {
+	res.Set("Content-Length", "0")
+	res.ww.WriteHeader(status)
+}
+
+// preflightHandlers returns the chain of an automatic OPTIONS route: the
+// policy answers preflight requests, and other OPTIONS requests get the
+// allowed methods.
+func (p *corsPolicy) preflightHandlers(methods []string) []Handler {
+	allow := strings.Join(append([]string{http.MethodOptions}, methods...), ", ")
+	return []Handler{
+		p.handler(methods),
+		func(res Response, req *Request, next NextFunc) {
+			res.Set("Allow", allow)
+			endPreflight(res, http.StatusNoContent)
+		},
+	}
+}
+
+// CORS returns a Handler that sets the CORS response headers for allowed
+// origins and answers preflight requests. Used with Use, it only sees
+// preflight requests for paths with an OPTIONS route; Route.CORS registers
+// those automatically.
+func CORS(options *CORSOptions) Handler {
+	return newCORSPolicy(options).handler(defaultCORSMethods)
+}
+
+// CORS applies a CORS policy to the routes of this router and the routers
+// nested under it, unless they set their own, so that "/api" can have a
+// different policy from "/". The policy runs before any middleware, and
+// every path without an OPTIONS route gets one answering preflight
+// requests with the methods registered for it.
+func (r *route) CORS(options *CORSOptions) *route {
+	r.cors = newCORSPolicy(options)
+	return r
+}
+
+// corsPolicy returns the policy set on this router or the nearest parent.
+func (r *route) corsPolicy() *corsPolicy {
+	for current := r; current != nil; current = current.parent {
+		if current.cors != nil {
+			return current.cors
+		}
+	}
+	return nil
+}
+
+// preflightPaths returns the methods registered for each path of the
+// router and, sorted, the paths that need a preflight route. Paths in
+// registered, which holds every path with an OPTIONS route, are skipped, and
+// the returned ones are added to it.
+func (r *route) preflightPaths(registered map[string]bool) (names []string, methods map[string][]string) {
+	methods = make(map[string][]string)
+	for _, path := range r.paths {
+		if path.method == http.MethodOptions {
+			continue
+		}
+		if _, ok := methods[path.name]; !ok && !registered[path.name] {
+			names = append(names, path.name)
+		}
+		methods[path.name] = append(methods[path.name], path.method)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		registered[name] = true
+	}
+	return names, methods
+}
+
+// optionsPaths returns every path of the router and the routers nested
+// under it that has an OPTIONS route.
+func (r *route) optionsPaths(paths map[string]bool) map[string]bool {
+	for _, path := range r.paths {
+		if path.method == http.MethodOptions {
+			paths[path.name] = true
+		}
+	}
+	for _, child := range r.children {
+		child.optionsPaths(paths)
+	}
+	return paths
+}
@@ -0,0 +1,152 @@
+package coco_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func newCORSApp() *coco.App {
+	ok := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	}
+	deny := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.SendStatus(http.StatusUnauthorized)
+	}
+
+	app := coco.NewApp()
+	app.CORS(nil)
+	app.Get("/", ok)
+
+	api := app.NewRouter("/api")
+	api.CORS(&coco.CORSOptions{
+		Origins:        []string{"https://app.example.com", "https://*.example.org"},
+		OriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+		AllowOriginFunc: func(origin string, req *coco.Request) bool {
+			return origin == "https://partner.test"
+		},
+		ExposedHeaders: []string{"X-Total"},
+		Credentials:    true,
+		MaxAge:         10 * time.Minute,
+	})
+	api.Use(deny)
+	api.Get("/items", ok)
+	api.Post("/items", ok)
+	api.Options("/custom", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("custom")
+	})
+	api.Get("/custom", ok)
+	return app
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	app := newCORSApp()
+
+	resp, body := doRequest(t, app, http.MethodGet, "/", map[string]string{"Origin": "https://evil.test"})
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header.Get("Vary"), "a fixed answer does not vary by origin")
+
+	resp, _ = doRequest(t, app, http.MethodOptions, "/", map[string]string{
+		"Origin":                         "https://evil.test",
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "X-Custom",
+	})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "GET", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "X-Custom", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Access-Control-Request-Headers", resp.Header.Get("Vary"))
+}
+
+func TestCORS_Allowlist(t *testing.T) {
+	app := newCORSApp()
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://eu.cdn.example.org", true},
+		{"https://example.org", false},
+		{"http://api.example.org", false},
+		{"http://localhost:3000", true},
+		{"http://localhost", false},
+		{"https://partner.test", true},
+		{"https://app.example.com.evil.test", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			resp, _ := doRequest(t, app, http.MethodOptions, "/api/items", map[string]string{
+				"Origin":                        tt.origin,
+				"Access-Control-Request-Method": "POST",
+			})
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, "preflights skip the router middleware")
+			assert.Equal(t, "Origin", resp.Header.Get("Vary"))
+			if !tt.allowed {
+				assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+				return
+			}
+			assert.Equal(t, tt.origin, resp.Header.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, "GET, POST", resp.Header.Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+		})
+	}
+}
+
+func TestCORS_ActualRequest(t *testing.T) {
+	app := newCORSApp()
+
+	resp, _ := doRequest(t, app, http.MethodGet, "/api/items", map[string]string{"Origin": "https://app.example.com"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "actual requests run the middleware")
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Total", resp.Header.Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", resp.Header.Get("Vary"))
+
+	resp, _ = doRequest(t, app, http.MethodGet, "/api/items", nil)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", resp.Header.Get("Vary"))
+}
+
+func TestCORS_OptionsRoutes(t *testing.T) {
+	app := newCORSApp()
+
+	resp, _ := doRequest(t, app, http.MethodOptions, "/api/items", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "OPTIONS, GET, POST", resp.Header.Get("Allow"))
+
+	resp, body := doRequest(t, app, http.MethodOptions, "/api/custom", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "explicit OPTIONS routes are kept")
+	assert.NotEqual(t, "custom", body)
+
+	resp, _ = doRequest(t, app, http.MethodOptions, "/api/custom", map[string]string{
+		"Origin":                        "https://app.example.com",
+		"Access-Control-Request-Method": "GET",
+	})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "GET", resp.Header.Get("Access-Control-Allow-Methods"))
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	app := coco.NewApp()
+	app.Use(coco.CORS(&coco.CORSOptions{Origins: []string{"https://app.example.com"}}))
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	})
+	app.Options("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.SendStatus(http.StatusTeapot)
+	})
+
+	resp, _ := doRequest(t, app, http.MethodOptions, "/", map[string]string{
+		"Origin":                        "https://app.example.com",
+		"Access-Control-Request-Method": "PUT",
+	})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, PUT, PATCH, POST, DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+}
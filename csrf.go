@@ -0,0 +1,294 @@
+package coco
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	csrfSessionKey    = "coco.csrf"
+	csrfSecretSize    = 32
+	defaultCSRFField  = "_csrf"
+	defaultCSRFHeader = "X-CSRF-Token"
+	defaultCSRFCookie = "coco.csrf"
+
+	defaultCSRFMaxBodySize      int64 = 1 << 20
+	defaultCSRFMaxMultipartSize int64 = 32 << 20
+)
+
+// CSRFMode selects where the CSRF middleware keeps the secret that tokens
+// are checked against.
+type CSRFMode int
+
+const (
+	// CSRFSynchronizer keeps the secret in the session, and requires the
+	// Sessions middleware to run first.
+	CSRFSynchronizer CSRFMode = iota
+
+	// CSRFDoubleSubmit keeps the secret in a cookie, signed with the App's
+	// cookie secrets when they are set, and checks that requests echo it.
+	CSRFDoubleSubmit
+)
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Mode is CSRFSynchronizer or CSRFDoubleSubmit. Defaults to
+	// CSRFSynchronizer.
+	Mode CSRFMode
+
+	// FieldName is the form field, or top-level JSON field, read for the
+	// token. Defaults to "_csrf".
+	FieldName string
+
+	// HeaderName is the request header read for the token, which takes
+	// precedence over the body. Defaults to "X-CSRF-Token".
+	HeaderName string
+
+	// IgnoreMethods are the methods that are not checked. Defaults to GET,
+	// HEAD, OPTIONS and TRACE.
+	IgnoreMethods []string
+
+	// CookieName is the name of the secret cookie in CSRFDoubleSubmit mode.
+	// Defaults to "coco.csrf".
+	CookieName string
+
+	// Path, Domain, Secure and SameSite are applied to the secret cookie,
+	// which is always HttpOnly. Path defaults to "/" and SameSite to Lax.
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+
+	// MaxBodySize is the largest URL encoded or JSON body buffered to look
+	// for the token. Larger bodies are rejected with 413 Request Entity Too
+	// Large. Defaults to 1MB.
+	MaxBodySize int64
+
+	// MaxMultipartSize is the largest multipart body buffered to look for
+	// the token. Defaults to 32MB.
+	MaxMultipartSize int64
+}
+
+// csrfState is the CSRF state of a request using the middleware.
+type csrfState struct {
+	options *CSRFOptions
+	secret  []byte
+	token   string
+}
+
+// CSRF returns a Handler that protects the routes after it against
+// cross-site request forgery. Requests using a method other than the
+// ignored ones must carry a token from Request.CSRFToken, in the header,
+// the form field or the JSON body, or they are rejected with 403 Forbidden.
+// Reading the body buffers it, so handlers can still read it afterwards.
+//
+// Templates rendered with Response.Render can call csrfToken for the token
+// and csrfField for a hidden input holding it.
+func CSRF(options *CSRFOptions) Handler {
+	opts := CSRFOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = defaultCSRFField
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = defaultCSRFHeader
+	}
+	if len(opts.IgnoreMethods) == 0 {
+		opts.IgnoreMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultCSRFCookie
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultCSRFMaxBodySize
+	}
+	if opts.MaxMultipartSize <= 0 {
+		opts.MaxMultipartSize = defaultCSRFMaxMultipartSize
+	}
+
+	return func(res Response, req *Request, next NextFunc) {
+		if opts.Mode == CSRFSynchronizer && req.session == nil {
+			res.Status(http.StatusInternalServerError).Send("CSRF synchronizer mode requires the Sessions middleware")
+			return
+		}
+
+		state := &csrfState{options: &opts}
+		state.secret = state.load(req)
+		req.csrf = state
+
+		for _, m := range opts.IgnoreMethods {
+			if strings.EqualFold(req.Method, m) {
+				next(res, req)
+				return
+			}
+		}
+
+		token, err := submittedCSRFToken(req, &opts)
+		var e Error
+		if errors.As(err, &e) && e.Code == http.StatusRequestEntityTooLarge {
+			res.Status(e.Code).Send(e.Message)
+			return
+		}
+		if state.secret == nil || !csrfTokenMatches(token, state.secret) {
+			res.Status(http.StatusForbidden).Send("invalid CSRF token")
+			return
+		}
+		next(res, req)
+	}
+}
+
+func (s *csrfState) load(req *Request) []byte {
+	var encoded string
+	if s.options.Mode == CSRFSynchronizer {
+		encoded, _ = req.session.Get(csrfSessionKey).(string)
+	} else if len(req.app.secrets()) > 0 {
+		encoded = req.SignedCookies[s.options.CookieName]
+	} else {
+		encoded = req.Cookies[s.options.CookieName]
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != csrfSecretSize {
+		return nil
+	}
+	return secret
+}
+
+// save stores a newly generated secret in the session or the cookie.
+func (s *csrfState) save(req *Request) {
+	encoded := base64.RawURLEncoding.EncodeToString(s.secret)
+	if s.options.Mode == CSRFSynchronizer {
+		req.session.Set(csrfSessionKey, encoded)
+		return
+	}
+
+	if secrets := req.app.secrets(); len(secrets) > 0 {
+		encoded = signCookieValue(encoded, secrets[0])
+	}
+	opts := s.options
+	http.SetCookie(req.w, &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    encoded,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		Secure:   opts.Secure,
+		HttpOnly: true,
+		SameSite: opts.SameSite,
+	})
+}
+
+// CSRFToken returns a token for the request, to be sent back in a form
+// field, header or JSON body on the next unsafe request. Tokens are masked
+// with a fresh random value, so they differ between requests while staying
+// valid for the whole session, or the life of the cookie. It returns an
+// empty string when the CSRF middleware is not in use.
+func (req *Request) CSRFToken() string {
+	s := req.csrf
+	if s == nil {
+		return ""
+	}
+	if s.token != "" {
+		return s.token
+	}
+	if s.secret == nil {
+		s.secret = make([]byte, csrfSecretSize)
+		if _, err := rand.Read(s.secret); err != nil {
+			panic("coco: reading random CSRF secret: " + err.Error())
+		}
+		s.save(req)
+	}
+
+	masked := make([]byte, 2*csrfSecretSize)
+	if _, err := rand.Read(masked[:csrfSecretSize]); err != nil {
+		panic("coco: reading random CSRF mask: " + err.Error())
+	}
+	for i, b := range s.secret {
+		masked[csrfSecretSize+i] = b ^ masked[i]
+	}
+	s.token = base64.RawURLEncoding.EncodeToString(masked)
+	return s.token
+}
+
+// csrfField returns a hidden input holding the request's CSRF token.
+func (req *Request) csrfField() template.HTML {
+	token := req.CSRFToken()
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(req.csrf.options.FieldName) +
+		`" value="` + token + `">`)
+}
+
+func csrfTokenMatches(token string, secret []byte) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*csrfSecretSize {
+		return false
+	}
+	unmasked := make([]byte, csrfSecretSize)
+	for i := range unmasked {
+		unmasked[i] = masked[i] ^ masked[csrfSecretSize+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+// submittedCSRFToken reads the token from the header or, failing that, the
+// form field or JSON body field. Bodies are buffered up to the configured
+// limits, so that handlers can still read them.
+func submittedCSRFToken(req *Request, opts *CSRFOptions) (string, error) {
+	if token := req.r.Header.Get(opts.HeaderName); token != "" {
+		return token, nil
+	}
+
+	if req.r.Body == nil && !req.Body.Buffered() {
+		return "", nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.r.Header.Get("Content-Type"))
+	maxSize := opts.MaxBodySize
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "application/json":
+	case "multipart/form-data":
+		maxSize = opts.MaxMultipartSize
+	default:
+		return "", nil
+	}
+	if err := req.Body.Buffer(&BufferOptions{MaxSize: maxSize}); err != nil {
+		return "", err
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if _, err := req.Body.FormData(); err != nil {
+			return "", nil
+		}
+		return req.r.PostForm.Get(opts.FieldName), nil
+	case "multipart/form-data":
+		req.Body.open()
+		if err := req.r.ParseMultipartForm(maxSize); err != nil {
+			return "", nil
+		}
+		return req.r.PostFormValue(opts.FieldName), nil
+	default:
+		var fields map[string]json.RawMessage
+		if err := req.Body.JSON(&fields); err != nil {
+			return "", nil
+		}
+		var token string
+		_ = json.Unmarshal(fields[opts.FieldName], &token)
+		return token, nil
+	}
+}
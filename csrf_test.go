@@ -0,0 +1,166 @@
+package coco_test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+var csrfFieldPattern = regexp.MustCompile(`<input type="hidden" name="_csrf" value="([A-Za-z0-9_-]+)">`)
+
+func newCSRFApp(t *testing.T, options *coco.CSRFOptions, sessions bool) *coco.App {
+	appFS := afero.NewMemMapFs()
+	afero.WriteFile(appFS, "views/form.html", []byte(`<form>{{csrfField}}</form>`), 0644)
+
+	app := coco.NewApp()
+	assert.NoError(t, app.LoadTemplates(afero.NewIOFS(appFS), nil))
+	if sessions {
+		app.Use(coco.Sessions(nil))
+	}
+	app.Use(coco.CSRF(options))
+
+	app.Get("/form", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Render("form", nil)
+	})
+	app.Get("/token", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(req.CSRFToken())
+	})
+	app.Post("/submit", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		text, err := req.Body.Text()
+		assert.NoError(t, err)
+		res.Send(text)
+	})
+	return app
+}
+
+func TestCSRF(t *testing.T) {
+	modes := map[string]struct {
+		mode     coco.CSRFMode
+		sessions bool
+	}{
+		"synchronizer":  {coco.CSRFSynchronizer, true},
+		"double submit": {coco.CSRFDoubleSubmit, false},
+	}
+
+	for name, tt := range modes {
+		t.Run(name, func(t *testing.T) {
+			client, base := newSessionClient(t, newCSRFApp(t, &coco.CSRFOptions{Mode: tt.mode}, tt.sessions))
+
+			_, page := getBody(t, client, base+"/form")
+			match := csrfFieldPattern.FindStringSubmatch(page)
+			if !assert.Len(t, match, 2, page) {
+				return
+			}
+			token := match[1]
+
+			_, other := getBody(t, client, base+"/token")
+			assert.NotEqual(t, token, other, "tokens are masked per request")
+
+			form := url.Values{"_csrf": {token}, "name": {"coco"}}.Encode()
+			resp, err := client.Post(base+"/submit", "application/x-www-form-urlencoded", strings.NewReader(form))
+			assert.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, form, string(body), "the body can be read after the check")
+
+			payload := `{"_csrf":"` + other + `"}`
+			resp, err = client.Post(base+"/submit", "application/json", strings.NewReader(payload))
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			mw.WriteField("_csrf", token)
+			mw.Close()
+			resp, err = client.Post(base+"/submit", mw.FormDataContentType(), &buf)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			req, _ := http.NewRequest(http.MethodPost, base+"/submit", nil)
+			req.Header.Set("X-CSRF-Token", token)
+			resp, err = client.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			for _, bad := range []string{"", "forged", token[:len(token)-4] + "AAAA"} {
+				req, _ := http.NewRequest(http.MethodPost, base+"/submit", nil)
+				req.Header.Set("X-CSRF-Token", bad)
+				resp, err = client.Do(req)
+				assert.NoError(t, err)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode, bad)
+			}
+		})
+	}
+}
+
+func TestCSRF_CookieIsNotAToken(t *testing.T) {
+	app := newCSRFApp(t, &coco.CSRFOptions{Mode: coco.CSRFDoubleSubmit}, false)
+
+	resp, _ := doRequest(t, app, http.MethodGet, "/token", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	token := ""
+	for _, c := range resp.Cookies() {
+		if c.Name == "coco.csrf" {
+			assert.True(t, c.HttpOnly)
+			token = c.Value
+		}
+	}
+	assert.NotEmpty(t, token, "a secret cookie is issued with the first token")
+
+	resp, _ = doRequest(t, app, http.MethodPost, "/submit", map[string]string{"X-CSRF-Token": token})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "the cookie alone is not a token")
+}
+
+func TestCSRF_RequiresSessions(t *testing.T) {
+	app := newCSRFApp(t, nil, false)
+
+	resp, _ := doRequest(t, app, http.MethodGet, "/token", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestCSRF_MaxBodySize(t *testing.T) {
+	app := newCSRFApp(t, &coco.CSRFOptions{Mode: coco.CSRFDoubleSubmit, MaxBodySize: 64, MaxMultipartSize: 512}, false)
+	client, base := newSessionClient(t, app)
+
+	_, token := getBody(t, client, base+"/token")
+
+	form := url.Values{"_csrf": {token}, "name": {strings.Repeat("a", 64)}}.Encode()
+	resp, err := client.Post(base+"/submit", "application/x-www-form-urlencoded", strings.NewReader(form))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("_csrf", token)
+	mw.WriteField("name", strings.Repeat("a", 64))
+	mw.Close()
+	resp, err = client.Post(base+"/submit", mw.FormDataContentType(), &buf)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "multipart bodies have their own limit")
+
+	buf.Reset()
+	mw = multipart.NewWriter(&buf)
+	mw.WriteField("_csrf", token)
+	mw.WriteField("name", strings.Repeat("a", 512))
+	mw.Close()
+	resp, err = client.Post(base+"/submit", mw.FormDataContentType(), &buf)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
@@ -0,0 +1,398 @@
+package coco
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const defaultMultipartMaxMemory int64 = 32 << 20
+
+// Decoder parses a request body of a particular media type into dst.
+// params holds the Content-Type parameters, such as the multipart boundary.
+type Decoder interface {
+	Decode(r io.Reader, params map[string]string, dst interface{}) error
+}
+
+// DecoderFunc adapts an ordinary function to the Decoder interface.
+type DecoderFunc func(r io.Reader, params map[string]string, dst interface{}) error
+
+// Decode calls f(r, params, dst).
+func (f DecoderFunc) Decode(r io.Reader, params map[string]string, dst interface{}) error {
+	return f(r, params, dst)
+}
+
+// FormFile is an uploaded file decoded from a multipart/form-data body.
+type FormFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Content  []byte
+}
+
+type registeredDecoder struct {
+	mediaType string
+	decoder   Decoder
+}
+
+var (
+	// JSONDecoder decodes JSON bodies. Body.Decode uses the "json codec"
+	// setting when one is set, like Body.JSON.
+	JSONDecoder Decoder = jsonDecoder{}
+
+	// XMLDecoder decodes XML bodies with encoding/xml.
+	XMLDecoder Decoder = DecoderFunc(decodeXML)
+
+	// FormDecoder decodes application/x-www-form-urlencoded bodies into
+	// structs, using `form` struct tags or the field names.
+	FormDecoder Decoder = DecoderFunc(decodeURLEncoded)
+
+	// MultipartDecoder decodes multipart/form-data bodies into structs like
+	// FormDecoder. File parts are read into FormFile, *FormFile or []*FormFile
+	// fields, up to 32MB in total.
+	MultipartDecoder Decoder = DecoderFunc(decodeMultipart)
+
+	errDecodeDestination = errors.New("destination must be a non-nil pointer")
+)
+
+func defaultDecoders() []registeredDecoder {
+	return []registeredDecoder{
+		{mediaType: "application/json", decoder: JSONDecoder},
+		{mediaType: "application/xml", decoder: XMLDecoder},
+		{mediaType: "text/xml", decoder: XMLDecoder},
+		{mediaType: "application/x-www-form-urlencoded", decoder: FormDecoder},
+		{mediaType: "multipart/form-data", decoder: MultipartDecoder},
+	}
+}
+
+// RegisterDecoder registers a Decoder for a media type, used by Body.Decode.
+// Registering a media type again replaces its decoder.
+func (a *App) RegisterDecoder(mediaType string, decoder Decoder) {
+	mediaType = parseMediaType(mediaType)
+
+	a.codecsMutex.Lock()
+	defer a.codecsMutex.Unlock()
+	for i, d := range a.decoders {
+		if d.mediaType == mediaType {
+			a.decoders[i].decoder = decoder
+			return
+		}
+	}
+	a.decoders = append(a.decoders, registeredDecoder{mediaType: mediaType, decoder: decoder})
+}
+
+// decoderFor returns the decoder for mediaType and the list of supported
+// media types. Structured syntax suffixes such as "+json" fall back to the
+// decoder registered for the base type.
+func (a *App) decoderFor(mediaType string) (Decoder, []string) {
+	decoders := defaultDecoders()
+	if a != nil {
+		a.codecsMutex.RLock()
+		defer a.codecsMutex.RUnlock()
+		decoders = a.decoders
+	}
+
+	var fallback Decoder
+	supported := make([]string, 0, len(decoders))
+	for _, d := range decoders {
+		supported = append(supported, d.mediaType)
+		if d.mediaType == mediaType {
+			return d.decoder, supported
+		}
+		switch {
+		case d.mediaType == "application/json" && strings.HasSuffix(mediaType, "+json"):
+			fallback = d.decoder
+		case d.mediaType == "application/xml" && strings.HasSuffix(mediaType, "+xml"):
+			fallback = d.decoder
+		}
+	}
+	return fallback, supported
+}
+
+// Decode parses the request body into dst using the decoder registered for
+// the request’s Content-Type. It returns an Error with status 415 listing the
+// supported types when no decoder matches, and 400 when the body is invalid.
+func (body *Body) Decode(dst interface{}) error {
+	if dst == nil {
+		return Error{http.StatusBadRequest, "Destination interface is nil"}
+	}
+
+	contentType := body.req.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+
+	decoder, supported := body.app.decoderFor(mediaType)
+	if decoder == nil {
+		return Error{http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported Content-Type %q, supported types: %s", contentType, strings.Join(supported, ", "))}
+	}
+
+	if _, ok := decoder.(jsonDecoder); ok {
+		settings := newJSONSettings(body.setting)
+		decoder = jsonDecoder{settings: &settings}
+	}
+
+	rc, err := body.reader()
+	if err != nil {
+		return err
+	}
+	if rc == nil {
+		return Error{http.StatusBadRequest, "Request body is nil"}
+	}
+	defer rc.Close()
+
+	if err := decoder.Decode(rc, params, dst); err != nil {
+		var e Error
+		if errors.As(err, &e) {
+			return e
+		}
+		return Error{http.StatusBadRequest, "Error decoding request body: " + err.Error()}
+	}
+	return nil
+}
+
+// jsonDecoder decodes JSON with the settings of the request's route, which
+// Body.Decode fills in.
+type jsonDecoder struct {
+	settings *jsonSettings
+}
+
+func (d jsonDecoder) Decode(r io.Reader, params map[string]string, dst interface{}) error {
+	if d.settings == nil {
+		return json.NewDecoder(r).Decode(dst)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return d.settings.unmarshal(b, dst)
+}
+
+func decodeXML(r io.Reader, params map[string]string, dst interface{}) error {
+	return xml.NewDecoder(r).Decode(dst)
+}
+
+func decodeURLEncoded(r io.Reader, params map[string]string, dst interface{}) error {
+	values, err := readForm(r)
+	if err != nil {
+		return err
+	}
+	contentType := mime.FormatMediaType("application/x-www-form-urlencoded", params)
+	if values, err = decodeFormCharset(values, contentType, false); err != nil {
+		return err
+	}
+	return decodeForm(values, nil, dst)
+}
+
+func decodeMultipart(r io.Reader, params map[string]string, dst interface{}) error {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("missing multipart boundary")
+	}
+
+	values := url.Values{}
+	files := make(map[string][]*FormFile)
+	remaining := defaultMultipartMaxMemory
+
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		content, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		if err != nil {
+			return err
+		}
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return Error{http.StatusRequestEntityTooLarge, "Multipart body too large"}
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if part.FileName() == "" {
+			values.Add(name, string(content))
+			continue
+		}
+		files[name] = append(files[name], &FormFile{
+			Filename: part.FileName(),
+			Header:   part.Header,
+			Content:  content,
+		})
+	}
+
+	return decodeForm(values, files, dst)
+}
+
+var (
+	formFileType    = reflect.TypeOf(FormFile{})
+	formFilePtrType = reflect.TypeOf(&FormFile{})
+)
+
+// decodeForm copies form values and files into dst, which may be a pointer
+// to a struct, url.Values or map[string][]string.
+func decodeForm(values url.Values, files map[string][]*FormFile, dst interface{}) error {
+	switch d := dst.(type) {
+	case *url.Values:
+		*d = values
+		return nil
+	case *map[string][]string:
+		*d = values
+		return nil
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errDecodeDestination
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode form into %s", rv.Type())
+	}
+
+	valueKeys := make([]string, 0, len(values))
+	for k := range values {
+		valueKeys = append(valueKeys, k)
+	}
+	fileKeys := make([]string, 0, len(files))
+	for k := range files {
+		fileKeys = append(fileKeys, k)
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fv := rv.Field(i)
+		switch field.Type {
+		case formFileType, formFilePtrType, reflect.SliceOf(formFilePtrType):
+			if fs := files[formKey(fileKeys, name)]; len(fs) > 0 {
+				setFormFiles(fv, fs)
+			}
+			continue
+		}
+
+		vals := values[formKey(valueKeys, name)]
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setFormValue(fv, vals); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// formKey finds the key matching name, falling back to a case-insensitive
+// match so that untagged fields pick up lowercase form names.
+func formKey(keys []string, name string) string {
+	for _, k := range keys {
+		if k == name {
+			return k
+		}
+	}
+	for _, k := range keys {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return ""
+}
+
+func setFormFiles(fv reflect.Value, files []*FormFile) {
+	switch fv.Type() {
+	case formFileType:
+		fv.Set(reflect.ValueOf(*files[0]))
+	case formFilePtrType:
+		fv.Set(reflect.ValueOf(files[0]))
+	default:
+		fv.Set(reflect.ValueOf(files))
+	}
+}
+
+func setFormValue(fv reflect.Value, vals []string) error {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(fv.Type().Elem())
+		if err := setFormValue(v.Elem(), vals); err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFormScalar(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setFormScalar(fv, vals[0])
+}
+
+func setFormScalar(fv reflect.Value, val string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			if val != "on" {
+				return err
+			}
+			b = true
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
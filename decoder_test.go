@@ -0,0 +1,129 @@
+package coco
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type signupForm struct {
+	Name    string      `form:"name" json:"name" xml:"name"`
+	Age     int         `form:"age" json:"age" xml:"age"`
+	Tags    []string    `form:"tag" json:"tags" xml:"tag"`
+	Agree   bool        `json:"agree" xml:"agree"`
+	Avatar  *FormFile   `form:"avatar" json:"-" xml:"-"`
+	Skipped string      `form:"-" json:"-" xml:"-"`
+	Files   []*FormFile `form:"attachment" json:"-" xml:"-"`
+}
+
+func newDecodeBody(contentType string, body io.Reader) *Body {
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", contentType)
+	return &Body{req: req, app: NewApp()}
+}
+
+func TestBody_Decode(t *testing.T) {
+	t.Run("it should decode JSON including +json types", func(t *testing.T) {
+		for _, ct := range []string{"application/json", "application/vnd.api+json; charset=utf-8"} {
+			var form signupForm
+			err := newDecodeBody(ct, strings.NewReader(`{"name":"ada","age":36}`)).Decode(&form)
+			assert.NoError(t, err)
+			assert.Equal(t, "ada", form.Name)
+			assert.Equal(t, 36, form.Age)
+		}
+	})
+
+	t.Run("it should decode XML", func(t *testing.T) {
+		var form signupForm
+		err := newDecodeBody("application/xml", strings.NewReader(`<signup><name>ada</name><age>36</age></signup>`)).Decode(&form)
+		assert.NoError(t, err)
+		assert.Equal(t, "ada", form.Name)
+		assert.Equal(t, 36, form.Age)
+	})
+
+	t.Run("it should decode urlencoded forms into structs", func(t *testing.T) {
+		var form signupForm
+		body := "name=ada&age=36&tag=a&tag=b&agree=on&Skipped=x"
+		err := newDecodeBody("application/x-www-form-urlencoded", strings.NewReader(body)).Decode(&form)
+		assert.NoError(t, err)
+		assert.Equal(t, signupForm{Name: "ada", Age: 36, Tags: []string{"a", "b"}, Agree: true}, form)
+	})
+
+	t.Run("it should decode multipart forms with files", func(t *testing.T) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("name", "ada")
+		fw, _ := mw.CreateFormFile("avatar", "me.png")
+		fw.Write([]byte("png-bytes"))
+		fw, _ = mw.CreateFormFile("attachment", "a.txt")
+		fw.Write([]byte("a"))
+		fw, _ = mw.CreateFormFile("attachment", "b.txt")
+		fw.Write([]byte("b"))
+		mw.Close()
+
+		var form signupForm
+		err := newDecodeBody(mw.FormDataContentType(), &buf).Decode(&form)
+		assert.NoError(t, err)
+		assert.Equal(t, "ada", form.Name)
+		if assert.NotNil(t, form.Avatar) {
+			assert.Equal(t, "me.png", form.Avatar.Filename)
+			assert.Equal(t, "png-bytes", string(form.Avatar.Content))
+		}
+		assert.Len(t, form.Files, 2)
+	})
+
+	t.Run("it should report invalid form values", func(t *testing.T) {
+		var form signupForm
+		err := newDecodeBody("application/x-www-form-urlencoded", strings.NewReader("age=old")).Decode(&form)
+
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusBadRequest {
+			t.Fatalf("Expected Error with StatusBadRequest, got %v", err)
+		}
+	})
+
+	t.Run("it should reject urlencoded forms over 10MB", func(t *testing.T) {
+		var form signupForm
+		body := "name=" + strings.Repeat("a", 10<<20)
+		err := newDecodeBody("application/x-www-form-urlencoded", strings.NewReader(body)).Decode(&form)
+
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected Error with StatusRequestEntityTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("it should respond 415 with the supported types", func(t *testing.T) {
+		var form signupForm
+		err := newDecodeBody("text/yaml", strings.NewReader("name: ada")).Decode(&form)
+
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("Expected Error with StatusUnsupportedMediaType, got %v", err)
+		}
+		assert.Contains(t, e.Message, "application/json, application/xml")
+	})
+
+	t.Run("it should use registered decoders", func(t *testing.T) {
+		body := newDecodeBody("application/vnd.coco.name", strings.NewReader("ada"))
+		body.app.RegisterDecoder("application/vnd.coco.name", DecoderFunc(func(r io.Reader, params map[string]string, dst interface{}) error {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			dst.(*signupForm).Name = string(b)
+			return nil
+		}))
+
+		var form signupForm
+		assert.NoError(t, body.Decode(&form))
+		assert.Equal(t, "ada", form.Name)
+	})
+}
@@ -0,0 +1,277 @@
+package coco
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Encoder serialises a response value in a particular media type.
+type Encoder interface {
+	Encode(w io.Writer, req *Request, v interface{}) error
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(w io.Writer, req *Request, v interface{}) error
+
+// Encode calls f(w, req, v).
+func (f EncoderFunc) Encode(w io.Writer, req *Request, v interface{}) error {
+	return f(w, req, v)
+}
+
+type registeredEncoder struct {
+	mediaType string
+	encoder   Encoder
+}
+
+var (
+	// JSONEncoder encodes values as JSON.
+	JSONEncoder Encoder = EncoderFunc(encodeJSON)
+
+	// XMLEncoder encodes values with encoding/xml.
+	XMLEncoder Encoder = EncoderFunc(encodeXML)
+
+	// JSONPEncoder wraps the JSON encoding of a value in a call to the
+	// callback named by the query parameter from the "jsonp callback name"
+	// setting, falling back to plain JSON when no callback is given.
+	JSONPEncoder Encoder = EncoderFunc(encodeJSONP)
+
+	// CSVEncoder encodes slices of structs, or [][]string, as CSV with a
+	// header row taken from the `csv` struct tags or the field names.
+	CSVEncoder Encoder = EncoderFunc(encodeCSV)
+
+	// TextEncoder writes values using their default fmt formatting.
+	TextEncoder Encoder = EncoderFunc(encodeText)
+
+	// builtinEncoders are used when a handler explicitly sets a Content-Type
+	// that has no encoder registered on the App.
+	builtinEncoders = map[string]Encoder{
+		"application/json":       JSONEncoder,
+		"application/xml":        XMLEncoder,
+		"text/xml":               XMLEncoder,
+		"application/javascript": JSONPEncoder,
+		"text/javascript":        JSONPEncoder,
+		"text/csv":               CSVEncoder,
+		"text/plain":             TextEncoder,
+	}
+
+	jsonpCallbackSanitizer = regexp.MustCompile(`[^\[\]\w$.]`)
+
+	errCSVUnsupported = errors.New("csv: value must be a slice of structs or [][]string")
+)
+
+func defaultEncoders() []registeredEncoder {
+	return []registeredEncoder{
+		{mediaType: "application/json", encoder: JSONEncoder},
+	}
+}
+
+// RegisterEncoder registers an Encoder for a media type. Response.Send picks
+// among the registered encoders using the request’s Accept header, preferring
+// them in registration order when the client has no preference. Registering
+// a media type again replaces its encoder.
+func (a *App) RegisterEncoder(mediaType string, encoder Encoder) {
+	mediaType = parseMediaType(mediaType)
+
+	a.codecsMutex.Lock()
+	defer a.codecsMutex.Unlock()
+	for i, e := range a.encoders {
+		if e.mediaType == mediaType {
+			a.encoders[i].encoder = encoder
+			return
+		}
+	}
+	a.encoders = append(a.encoders, registeredEncoder{mediaType: mediaType, encoder: encoder})
+}
+
+// negotiateEncoder returns the registered encoder best matching the request’s
+// Accept header, falling back to the first registered encoder.
+func (a *App) negotiateEncoder(req *Request) (string, Encoder) {
+	a.codecsMutex.RLock()
+	defer a.codecsMutex.RUnlock()
+
+	if len(a.encoders) == 0 {
+		return "application/json", JSONEncoder
+	}
+
+	types := make([]string, len(a.encoders))
+	for i, e := range a.encoders {
+		types[i] = e.mediaType
+	}
+
+	best := types[0]
+	if req != nil {
+		if accepted := req.Accepts(types...); accepted != "" {
+			best = accepted
+		}
+	}
+	for _, e := range a.encoders {
+		if e.mediaType == best {
+			return e.mediaType, e.encoder
+		}
+	}
+	return a.encoders[0].mediaType, a.encoders[0].encoder
+}
+
+// encoderFor returns the encoder for an explicit media type, consulting the
+// registered encoders before the built-in ones.
+func (a *App) encoderFor(mediaType string) Encoder {
+	mediaType = parseMediaType(mediaType)
+	if mediaType == "" {
+		return nil
+	}
+
+	if a != nil {
+		a.codecsMutex.RLock()
+		for _, e := range a.encoders {
+			if e.mediaType == mediaType {
+				a.codecsMutex.RUnlock()
+				return e.encoder
+			}
+		}
+		a.codecsMutex.RUnlock()
+	}
+
+	if enc, ok := builtinEncoders[mediaType]; ok {
+		return enc
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return JSONEncoder
+	case strings.HasSuffix(mediaType, "+xml"):
+		return XMLEncoder
+	}
+	return nil
+}
+
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+func encodeJSON(w io.Writer, req *Request, v interface{}) error {
+	b, err := req.jsonSettings().marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func encodeXML(w io.Writer, req *Request, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// jsonpCallback returns the sanitised JSONP callback named in the query
+// string, or "" when there is none.
+func jsonpCallback(req *Request) string {
+	if req == nil || req.r == nil {
+		return ""
+	}
+
+	name := "callback"
+	if setting, ok := req.setting("jsonp callback name").(string); ok && setting != "" {
+		name = setting
+	}
+
+	values := req.r.URL.Query()[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return jsonpCallbackSanitizer.ReplaceAllString(values[0], "")
+}
+
+func encodeJSONP(w io.Writer, req *Request, v interface{}) error {
+	b, err := req.jsonSettings().marshal(v)
+	if err != nil {
+		return err
+	}
+
+	callback := jsonpCallback(req)
+	if callback == "" {
+		_, err = w.Write(b)
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "/**/ typeof %s === 'function' && %s(%s);", callback, callback, b)
+	return err
+}
+
+func encodeCSV(w io.Writer, req *Request, v interface{}) error {
+	cw := csv.NewWriter(w)
+
+	if rows, ok := v.([][]string); ok {
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return errCSVUnsupported
+	}
+
+	elemType := rv.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return errCSVUnsupported
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("csv"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		for j, idx := range fields {
+			record[j] = fmt.Sprint(elem.Field(idx).Interface())
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func encodeText(w io.Writer, req *Request, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
@@ -0,0 +1,165 @@
+package coco_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+type encoderItem struct {
+	XMLName xml.Name `json:"-" xml:"item" csv:"-"`
+	ID      int      `json:"id" xml:"id" csv:"id"`
+	Name    string   `json:"name" xml:"name" csv:"name"`
+	secret  string
+}
+
+func doRequest(t *testing.T, app *coco.App, method, path string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestResponseSend_Encoders(t *testing.T) {
+	app := coco.NewApp()
+	app.RegisterEncoder("application/xml", coco.XMLEncoder)
+	app.RegisterEncoder("text/csv", coco.CSVEncoder)
+	app.RegisterEncoder("application/x-custom", coco.EncoderFunc(func(w io.Writer, req *coco.Request, v interface{}) error {
+		_, err := io.WriteString(w, "custom")
+		return err
+	}))
+
+	item := encoderItem{ID: 1, Name: "coco", secret: "hidden"}
+	app.Get("/item", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(item)
+	})
+	app.Get("/items", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send([]encoderItem{item, {ID: 2, Name: "grape"}})
+	})
+	app.Get("/typed", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Type("txt").Send(42)
+	})
+	app.Get("/unencodable", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Type("html").Send(map[string]string{"name": "coco"})
+	})
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"json by default", "/item", "", "application/json; charset=utf-8", `{"id":1,"name":"coco"}`},
+		{"json for wildcard", "/item", "*/*", "application/json; charset=utf-8", `{"id":1,"name":"coco"}`},
+		{"xml when preferred", "/item", "application/xml, application/json;q=0.5", "application/xml", `<item><id>1</id><name>coco</name></item>`},
+		{"csv for slices", "/items", "text/csv", "text/csv; charset=utf-8", "id,name\n1,coco\n2,grape\n"},
+		{"custom encoder", "/item", "application/x-custom", "application/x-custom", "custom"},
+		{"json when nothing matches", "/item", "image/png", "application/json; charset=utf-8", `{"id":1,"name":"coco"}`},
+		{"explicit content type", "/typed", "application/json", "text/plain; charset=utf-8", "42"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tc.accept != "" {
+				headers["Accept"] = tc.accept
+			}
+			resp, body := doRequest(t, app, "GET", tc.path, headers)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.contentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.body, body)
+		})
+	}
+
+	t.Run("explicit content type without an encoder", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/unencodable", map[string]string{"Accept": "application/json"})
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, "no encoder for text/html\n", body)
+	})
+}
+
+func TestResponseFormat_Encoders(t *testing.T) {
+	app := coco.NewApp()
+
+	app.Get("/item", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		send := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+			res.Send(encoderItem{ID: 1, Name: "coco"})
+		}
+		res.Format(
+			coco.FormatHandler{Type: "json", Handler: send},
+			coco.FormatHandler{Type: "xml", Handler: send},
+		)
+	})
+
+	resp, body := doRequest(t, app, "GET", "/item", map[string]string{"Accept": "application/xml"})
+
+	assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `<item><id>1</id><name>coco</name></item>`, body)
+}
+
+func TestResponseJSONP(t *testing.T) {
+	app := coco.NewApp()
+
+	app.Get("/jsonp", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.JSONP(map[string]int{"count": 1})
+	})
+
+	t.Run("it should wrap the payload in the callback", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/jsonp?callback=handle", nil)
+
+		assert.Equal(t, "text/javascript; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		assert.Equal(t, `/**/ typeof handle === 'function' && handle({"count":1});`, body)
+	})
+
+	t.Run("it should sanitize the callback name", func(t *testing.T) {
+		_, body := doRequest(t, app, "GET", "/jsonp?callback=alert(1)%3Bx", nil)
+
+		assert.True(t, strings.HasPrefix(body, "/**/ typeof alert1x === 'function'"), body)
+	})
+
+	t.Run("it should honour the jsonp callback name setting", func(t *testing.T) {
+		app.SetSetting("jsonp callback name", "cb")
+		defer app.SetSetting("jsonp callback name", "callback")
+
+		_, body := doRequest(t, app, "GET", "/jsonp?cb=done", nil)
+
+		assert.Equal(t, `/**/ typeof done === 'function' && done({"count":1});`, body)
+	})
+
+	t.Run("it should send plain JSON without a callback", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/jsonp", nil)
+
+		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `{"count":1}`, body)
+	})
+}
+
+func TestCSVEncoder(t *testing.T) {
+	var sb strings.Builder
+	err := coco.CSVEncoder.Encode(&sb, nil, map[string]string{"a": "b"})
+	assert.Error(t, err)
+
+	sb.Reset()
+	err = coco.CSVEncoder.Encode(&sb, nil, [][]string{{"a", "b"}, {"1", "2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", sb.String())
+}
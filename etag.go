@@ -0,0 +1,73 @@
+package coco
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// ETagFunc generates the ETag for a response body. Set one as the "etag"
+// setting to replace the built-in generator. Returning an empty string
+// leaves the response without an ETag.
+type ETagFunc func(body []byte) string
+
+// etagFunc returns the ETag generator selected by the "etag" setting: true
+// or "weak" for weak ETags, "strong" for strong ones, false to disable, or
+// an ETagFunc.
+func etagFunc(setting interface{}) ETagFunc {
+	switch v := setting.(type) {
+	case ETagFunc:
+		return v
+	case func([]byte) string:
+		return v
+	case bool:
+		if v {
+			return WeakETag
+		}
+	case string:
+		switch v {
+		case "weak":
+			return WeakETag
+		case "strong":
+			return StrongETag
+		}
+	}
+	return nil
+}
+
+// StrongETag returns a strong ETag for body, made of its length and a hash
+// of its content.
+func StrongETag(body []byte) string {
+	sum := sha1.Sum(body)
+	hash := base64.StdEncoding.EncodeToString(sum[:])[:27]
+	return `"` + strconv.FormatInt(int64(len(body)), 16) + "-" + hash + `"`
+}
+
+// WeakETag returns a weak ETag for body, like StrongETag with the W/ prefix.
+func WeakETag(body []byte) string {
+	return "W/" + StrongETag(body)
+}
+
+// ETagFor returns a strong ETag for body, made by the generator selected by
+// the route's "etag" setting with any W/ prefix removed, or by StrongETag
+// when the setting is disabled. Weak ETags, the default, never satisfy
+// If-Match, so handlers accepting conditional writes should send ETagFor
+// when the resource is read and check writes against it:
+//
+//	res.Set("ETag", res.ETagFor(doc)).Send(doc)
+//	...
+//	if res.CheckPreconditions(res.ETagFor(doc), time.Time{}) {
+func (r *Response) ETagFor(body []byte) string {
+	var generate ETagFunc
+	if req := r.request(); req != nil {
+		generate = etagFunc(req.setting("etag"))
+	}
+	if generate == nil {
+		return StrongETag(body)
+	}
+	if etag := strings.TrimPrefix(generate(body), "W/"); etag != "" {
+		return etag
+	}
+	return StrongETag(body)
+}
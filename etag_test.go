@@ -0,0 +1,94 @@
+package coco_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func TestETag(t *testing.T) {
+	assert.Equal(t, `"5-qvTGHdzF6KLavt4PO0gs2a6pQ00"`, coco.StrongETag([]byte("hello")))
+	assert.Equal(t, `W/"5-qvTGHdzF6KLavt4PO0gs2a6pQ00"`, coco.WeakETag([]byte("hello")))
+}
+
+func TestResponse_ETag(t *testing.T) {
+	app := coco.NewApp()
+
+	sendHello := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("hello")
+	}
+	app.Get("/text", sendHello)
+	app.Head("/text", sendHello)
+	app.Get("/json", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.JSON(map[string]string{"hello": "world"})
+	})
+	app.Get("/missing", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Status(http.StatusNotFound).Send("hello")
+	})
+	app.Post("/text", sendHello)
+	app.Get("/tagged", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("ETag", `"v1"`).Send("hello")
+	})
+	strong := app.NewRouter("/strong").SetSetting("etag", "strong")
+	strong.Get("/text", sendHello)
+
+	weak := `W/"5-qvTGHdzF6KLavt4PO0gs2a6pQ00"`
+
+	t.Run("it should send weak ETags by default", func(t *testing.T) {
+		resp, _ := doRequest(t, app, "GET", "/text", nil)
+		assert.Equal(t, weak, resp.Header.Get("ETag"))
+
+		resp, _ = doRequest(t, app, "GET", "/json", nil)
+		assert.NotEmpty(t, resp.Header.Get("ETag"))
+	})
+
+	t.Run("it should honour router settings", func(t *testing.T) {
+		resp, _ := doRequest(t, app, "GET", "/strong/text", nil)
+		assert.Equal(t, `"5-qvTGHdzF6KLavt4PO0gs2a6pQ00"`, resp.Header.Get("ETag"))
+	})
+
+	t.Run("it should reply 304 to fresh requests", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/text", map[string]string{"If-None-Match": weak})
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Empty(t, body)
+		assert.Empty(t, resp.Header.Get("Content-Type"))
+
+		resp, _ = doRequest(t, app, "HEAD", "/text", map[string]string{"If-None-Match": weak})
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp, _ = doRequest(t, app, "GET", "/tagged", map[string]string{"If-None-Match": `"v1"`})
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("it should send the body to stale requests", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/text", map[string]string{"If-None-Match": `W/"other"`})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "hello", body)
+	})
+
+	t.Run("it should skip non-2xx responses and other methods", func(t *testing.T) {
+		resp, body := doRequest(t, app, "GET", "/missing", map[string]string{"If-None-Match": weak})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("ETag"))
+		assert.Equal(t, "hello", body)
+
+		resp, _ = doRequest(t, app, "POST", "/text", map[string]string{"If-None-Match": weak})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("it should honour disabled and custom generators", func(t *testing.T) {
+		app.SetSetting("etag", false)
+		resp, _ := doRequest(t, app, "GET", "/text", nil)
+		assert.Empty(t, resp.Header.Get("ETag"))
+
+		app.SetSetting("etag", coco.ETagFunc(func(body []byte) string {
+			return `"custom"`
+		}))
+		resp, _ = doRequest(t, app, "GET", "/text", nil)
+		assert.Equal(t, `"custom"`, resp.Header.Get("ETag"))
+
+		app.SetSetting("etag", "weak")
+	})
+}
@@ -0,0 +1,163 @@
+package coco
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// flashKey is the session key, or signed cookie name, holding the pending
+// flash messages.
+const flashKey = "coco.flash"
+
+// Flash is a one-time message set with Response.Flash, typically before a
+// redirect, and shown on the next page.
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// flashes holds the pending flash messages of a request. They are kept in
+// the session when the Sessions middleware is in use and in a signed cookie
+// otherwise.
+type flashes struct {
+	mu       sync.Mutex
+	req      *Request
+	messages []Flash
+	hooked   bool
+}
+
+func (req *Request) flashes() *flashes {
+	if req.flash == nil {
+		req.flash = &flashes{req: req, messages: loadFlashes(req)}
+	}
+	return req.flash
+}
+
+func loadFlashes(req *Request) []Flash {
+	var encoded string
+	if s := req.session; s != nil {
+		encoded, _ = s.Get(flashKey).(string)
+	} else if value, ok := req.SignedCookies[flashKey]; ok {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil
+		}
+		encoded = string(b)
+	}
+	if encoded == "" {
+		return nil
+	}
+
+	var messages []Flash
+	if err := json.Unmarshal([]byte(encoded), &messages); err != nil {
+		return nil
+	}
+	return messages
+}
+
+// save stores the pending messages. f.mu is held.
+func (f *flashes) save() {
+	req := f.req
+	if s := req.session; s != nil {
+		if len(f.messages) == 0 {
+			s.Delete(flashKey)
+			return
+		}
+		b, _ := json.Marshal(f.messages)
+		s.Set(flashKey, string(b))
+		return
+	}
+
+	// The cookie is written once, just before the headers, with whatever is
+	// pending by then.
+	if f.hooked {
+		return
+	}
+	ww, ok := req.w.(*wrappedWriter)
+	if !ok {
+		return
+	}
+	f.hooked = true
+	ww.onBeforeWrite(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.writeCookie(ww)
+	})
+}
+
+func (f *flashes) writeCookie(w http.ResponseWriter) {
+	req := f.req
+	if len(f.messages) == 0 {
+		if _, ok := req.SignedCookies[flashKey]; ok {
+			http.SetCookie(w, &http.Cookie{Name: flashKey, Path: "/", MaxAge: -1, HttpOnly: true})
+		}
+		return
+	}
+
+	secrets := req.app.secrets()
+	if len(secrets) == 0 {
+		log.Printf("coco: flash messages require the Sessions middleware or App.SetCookieSecrets")
+		return
+	}
+	b, _ := json.Marshal(f.messages)
+	cookie := &http.Cookie{
+		Name:     flashKey,
+		Value:    signCookieValue(base64.RawURLEncoding.EncodeToString(b), secrets[0]),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if len(cookie.String()) > maxCookieSize {
+		log.Printf("coco: flash messages dropped: %v", ErrCookieTooLarge)
+		return
+	}
+	http.SetCookie(w, cookie)
+}
+
+// Flash adds a message of the given kind, such as "info" or "error", to be
+// read with Request.Flashes, usually on the next request after a redirect.
+// Messages are kept in the session when the Sessions middleware is in use,
+// and otherwise in a cookie signed with the App's cookie secrets.
+func (r *Response) Flash(kind, message string) *Response {
+	f := r.request().flashes()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, Flash{Kind: kind, Message: message})
+	f.save()
+	return r
+}
+
+// Flashes returns the pending flash messages of the given kinds, or all of
+// them when no kind is given, and removes them so that they are only shown
+// once. Templates rendered with Response.Render can call it as flashes.
+func (req *Request) Flashes(kinds ...string) []Flash {
+	f := req.flashes()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matched, kept []Flash
+	for _, flash := range f.messages {
+		if len(kinds) == 0 || containsString(kinds, flash.Kind) {
+			matched = append(matched, flash)
+		} else {
+			kept = append(kept, flash)
+		}
+	}
+	if len(matched) > 0 {
+		f.messages = kept
+		f.save()
+	}
+	return matched
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
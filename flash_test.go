@@ -0,0 +1,70 @@
+package coco_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func newFlashApp(t *testing.T, sessions bool) *coco.App {
+	appFS := afero.NewMemMapFs()
+	afero.WriteFile(appFS, "views/layout.html", []byte(`{{block "main" .}}{{end}}`), 0644)
+	afero.WriteFile(appFS, "views/index.html",
+		[]byte(`{{define "main"}}{{range flashes "info"}}[{{.Kind}}: {{.Message}}]{{end}}{{end}}`), 0644)
+
+	app := coco.NewApp()
+	app.SetCookieSecrets("secret")
+	assert.NoError(t, app.LoadTemplates(afero.NewIOFS(appFS), nil))
+	if sessions {
+		app.Use(coco.Sessions(nil))
+	}
+
+	app.Post("/save", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Flash("info", "Saved").Flash("error", "Slow disk").Redirect("/")
+	})
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Render("index", nil)
+	})
+	app.Get("/errors", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.JSON(req.Flashes("error"))
+	})
+	return app
+}
+
+func TestFlash(t *testing.T) {
+	for name, sessions := range map[string]bool{"session": true, "cookie": false} {
+		t.Run(name, func(t *testing.T) {
+			client, url := newSessionClient(t, newFlashApp(t, sessions))
+
+			resp, err := client.Post(url+"/save", "text/plain", nil)
+			assert.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "[info: Saved]", string(body), "the redirect target shows the flash")
+
+			_, page := getBody(t, client, url+"/")
+			assert.Equal(t, "", page, "flashes are shown once")
+
+			_, errors := getBody(t, client, url+"/errors")
+			assert.JSONEq(t, `[{"kind":"error","message":"Slow disk"}]`, errors, "only the rendered kind is consumed")
+
+			_, errors = getBody(t, client, url+"/errors")
+			assert.Equal(t, "null", errors)
+		})
+	}
+}
+
+func TestFlash_TamperedCookie(t *testing.T) {
+	app := newFlashApp(t, false)
+
+	resp, body := doRequest(t, app, http.MethodGet, "/errors", map[string]string{
+		"Cookie": "coco.flash=" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.W3sia2luZCI6ImVycm9yIiwibWVzc2FnZSI6Im93bmVkIn1d",
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "null", body)
+}
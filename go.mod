@@ -5,15 +5,14 @@ go 1.18
 require (
 	github.com/go-http-utils/fresh v0.0.0-20161124030543-7231e26a4b27
 	github.com/julienschmidt/httprouter v1.3.0
-	github.com/noelukwa/tempest v1.2.0
 	github.com/spf13/afero v1.10.0
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/text v0.3.7
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-http-utils/headers v0.0.0-20181008091004-fed159eddc2a // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
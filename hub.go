@@ -0,0 +1,307 @@
+package coco
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultHubBufferSize = 64
+	defaultHubReplaySize = 100
+)
+
+// ErrSlowConsumer is returned by HubClient.Serve when the client was
+// disconnected by the Disconnect policy for falling behind.
+var ErrSlowConsumer = errors.New("hub client disconnected: too slow")
+
+// SlowConsumerPolicy decides what a Hub does when a client’s buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest SlowConsumerPolicy = iota
+	// DropNewest discards the event being published.
+	DropNewest
+	// Disconnect closes the client.
+	Disconnect
+)
+
+// HubOptions configures a Hub.
+type HubOptions struct {
+	// BufferSize is the number of events buffered per client. Defaults to 64.
+	BufferSize int
+	// Policy applies when a client’s buffer is full. Defaults to DropOldest.
+	Policy SlowConsumerPolicy
+	// ReplaySize is the number of recent events kept for clients that
+	// reconnect with a Last-Event-ID. Defaults to 100; negative disables
+	// replay.
+	ReplaySize int
+}
+
+// HubEvent is a message published to a Hub topic.
+type HubEvent struct {
+	ID    string
+	Topic string
+	Data  interface{}
+}
+
+// HubStats is a snapshot of a Hub’s metrics.
+type HubStats struct {
+	// Clients is the number of connected clients.
+	Clients int
+	// Subscribers maps each topic to its number of subscribed clients.
+	Subscribers map[string]int
+	// Published counts the events published.
+	Published uint64
+	// Delivered counts the events queued to clients.
+	Delivered uint64
+	// Dropped counts the events discarded because a buffer was full.
+	Dropped uint64
+	// Disconnected counts the clients closed by the Disconnect policy.
+	Disconnected uint64
+}
+
+// Hub fans published events out to clients subscribed to their topics.
+// It is safe for concurrent use.
+type Hub struct {
+	options HubOptions
+
+	mu      sync.Mutex
+	clients map[string]*HubClient
+	replay  []HubEvent
+	lastID  uint64
+	nextID  uint64
+	stats   HubStats
+}
+
+// HubClient is a consumer connected to a Hub.
+type HubClient struct {
+	hub    *Hub
+	id     string
+	events chan HubEvent
+	topics map[string]bool
+	done   chan struct{}
+	err    error
+}
+
+// NewHub creates a Hub.
+func NewHub(options HubOptions) *Hub {
+	if options.BufferSize <= 0 {
+		options.BufferSize = defaultHubBufferSize
+	}
+	if options.ReplaySize == 0 {
+		options.ReplaySize = defaultHubReplaySize
+	}
+	return &Hub{
+		options: options,
+		clients: make(map[string]*HubClient),
+	}
+}
+
+// Publish sends data to every client subscribed to topic and returns the
+// event ID.
+func (h *Hub) Publish(topic string, data interface{}) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	ev := HubEvent{ID: strconv.FormatUint(h.lastID, 10), Topic: topic, Data: data}
+	h.stats.Published++
+
+	if h.options.ReplaySize > 0 {
+		h.replay = append(h.replay, ev)
+		if len(h.replay) > h.options.ReplaySize {
+			h.replay = h.replay[len(h.replay)-h.options.ReplaySize:]
+		}
+	}
+
+	for _, c := range h.clients {
+		if c.topics[topic] && !h.deliver(c, ev) {
+			// c was disconnected and removed from h.clients, which is
+			// safe while ranging over it; nothing more is sent to it.
+			continue
+		}
+	}
+	return ev.ID
+}
+
+// deliver queues ev for c, applying the slow consumer policy, and reports
+// whether c is still connected. h.mu is held.
+func (h *Hub) deliver(c *HubClient, ev HubEvent) bool {
+	for {
+		select {
+		case c.events <- ev:
+			h.stats.Delivered++
+			return true
+		default:
+		}
+
+		switch h.options.Policy {
+		case DropNewest:
+			h.stats.Dropped++
+			return true
+		case Disconnect:
+			h.stats.Disconnected++
+			c.err = ErrSlowConsumer
+			h.remove(c)
+			return false
+		default:
+			select {
+			case <-c.events:
+				h.stats.Dropped++
+			default:
+			}
+		}
+	}
+}
+
+// Connect registers a client subscribed to topics. If lastEventID is the ID
+// of a retained event, later events on those topics are queued for replay.
+func (h *Hub) Connect(lastEventID string, topics ...string) *HubClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	c := &HubClient{
+		hub:    h,
+		id:     strconv.FormatUint(h.nextID, 10),
+		events: make(chan HubEvent, h.options.BufferSize),
+		topics: make(map[string]bool),
+		done:   make(chan struct{}),
+	}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	h.clients[c.id] = c
+
+	if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		for _, ev := range h.replay {
+			id, _ := strconv.ParseUint(ev.ID, 10, 64)
+			if id > last && c.topics[ev.Topic] && !h.deliver(c, ev) {
+				break
+			}
+		}
+	}
+	return c
+}
+
+// Client returns the connected client with the given ID, or nil.
+func (h *Hub) Client(id string) *HubClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.clients[id]
+}
+
+// Stats returns a snapshot of the hub’s metrics.
+func (h *Hub) Stats() HubStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := h.stats
+	stats.Clients = len(h.clients)
+	stats.Subscribers = make(map[string]int)
+	for _, c := range h.clients {
+		for topic := range c.topics {
+			stats.Subscribers[topic]++
+		}
+	}
+	return stats
+}
+
+// Serve streams the topics to the client as Server-Sent Events, replaying
+// missed events when it reconnects with a Last-Event-ID, until either side
+// goes away. Each event’s topic is used as the SSE event name.
+func (h *Hub) Serve(res Response, req *Request, topics ...string) error {
+	return h.Connect(req.Get("Last-Event-ID"), topics...).Serve(res)
+}
+
+// remove unregisters c and closes its channels. h.mu is held.
+func (h *Hub) remove(c *HubClient) {
+	if _, ok := h.clients[c.id]; !ok {
+		return
+	}
+	delete(h.clients, c.id)
+	close(c.events)
+	close(c.done)
+}
+
+// ID returns the client’s ID, which handlers can use with Hub.Client to
+// change its subscriptions from other requests.
+func (c *HubClient) ID() string {
+	return c.id
+}
+
+// Events returns the client’s event channel. It is closed when the client
+// is closed.
+func (c *HubClient) Events() <-chan HubEvent {
+	return c.events
+}
+
+// Done returns a channel that is closed when the client is closed.
+func (c *HubClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Subscribe adds topics to the client’s subscriptions.
+func (c *HubClient) Subscribe(topics ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+}
+
+// Unsubscribe removes topics from the client’s subscriptions.
+func (c *HubClient) Unsubscribe(topics ...string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+// Topics returns the topics the client is subscribed to.
+func (c *HubClient) Topics() []string {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Close disconnects the client from the hub.
+func (c *HubClient) Close() {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.remove(c)
+}
+
+// Serve streams the client’s events to res as Server-Sent Events until the
+// request ends or the client is closed, then closes the client. It returns
+// ErrSlowConsumer if the hub disconnected the client for falling behind.
+func (c *HubClient) Serve(res Response) error {
+	defer c.Close()
+
+	stream := res.SSE()
+	defer stream.Close()
+
+	for {
+		select {
+		case <-stream.Done():
+			return nil
+		case ev, ok := <-c.events:
+			if !ok {
+				c.hub.mu.Lock()
+				err := c.err
+				c.hub.mu.Unlock()
+				return err
+			}
+			if err := stream.Send(ev.Topic, ev.ID, ev.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package coco_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func drain(c *coco.HubClient) []interface{} {
+	var data []interface{}
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				return data
+			}
+			data = append(data, ev.Data)
+		default:
+			return data
+		}
+	}
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := coco.NewHub(coco.HubOptions{})
+
+	news := hub.Connect("", "news")
+	all := hub.Connect("", "news", "sport")
+
+	hub.Publish("news", 1)
+	hub.Publish("sport", 2)
+
+	assert.Equal(t, []interface{}{1}, drain(news))
+	assert.Equal(t, []interface{}{1, 2}, drain(all))
+
+	t.Run("it should follow subscription changes", func(t *testing.T) {
+		news.Subscribe("sport")
+		hub.Client(all.ID()).Unsubscribe("news")
+
+		hub.Publish("news", 3)
+		hub.Publish("sport", 4)
+
+		assert.Equal(t, []interface{}{3, 4}, drain(news))
+		assert.Equal(t, []interface{}{4}, drain(all))
+	})
+
+	t.Run("it should report stats", func(t *testing.T) {
+		stats := hub.Stats()
+		assert.Equal(t, 2, stats.Clients)
+		assert.Equal(t, map[string]int{"news": 1, "sport": 2}, stats.Subscribers)
+		assert.Equal(t, uint64(4), stats.Published)
+		assert.Equal(t, uint64(6), stats.Delivered)
+
+		news.Close()
+		assert.Nil(t, hub.Client(news.ID()))
+		assert.Equal(t, 1, hub.Stats().Clients)
+	})
+}
+
+func TestHub_SlowConsumers(t *testing.T) {
+	tests := []struct {
+		policy       coco.SlowConsumerPolicy
+		want         []interface{}
+		dropped      uint64
+		disconnected uint64
+	}{
+		{coco.DropOldest, []interface{}{2, 3}, 1, 0},
+		{coco.DropNewest, []interface{}{1, 2}, 1, 0},
+		{coco.Disconnect, []interface{}{1, 2}, 0, 1},
+	}
+
+	for _, tc := range tests {
+		hub := coco.NewHub(coco.HubOptions{BufferSize: 2, Policy: tc.policy})
+		c := hub.Connect("", "t")
+		for i := 1; i <= 3; i++ {
+			hub.Publish("t", i)
+		}
+
+		assert.Equal(t, tc.want, drain(c))
+		stats := hub.Stats()
+		assert.Equal(t, tc.dropped, stats.Dropped)
+		assert.Equal(t, tc.disconnected, stats.Disconnected)
+	}
+}
+
+func TestHub_Replay(t *testing.T) {
+	hub := coco.NewHub(coco.HubOptions{ReplaySize: 3})
+	for i := 1; i <= 5; i++ {
+		topic := "a"
+		if i == 4 {
+			topic = "b"
+		}
+		hub.Publish(topic, i)
+	}
+
+	assert.Equal(t, []interface{}{5}, drain(hub.Connect("3", "a")))
+	assert.Equal(t, []interface{}{3, 5}, drain(hub.Connect("1", "a")))
+	assert.Empty(t, drain(hub.Connect("", "a")))
+
+	t.Run("it should stop replaying to disconnected slow consumers", func(t *testing.T) {
+		hub := coco.NewHub(coco.HubOptions{BufferSize: 1, ReplaySize: 3, Policy: coco.Disconnect})
+		for i := 1; i <= 3; i++ {
+			hub.Publish("t", i)
+		}
+
+		c := hub.Connect("0", "t")
+		assert.Equal(t, []interface{}{1}, drain(c))
+		select {
+		case <-c.Done():
+		default:
+			t.Error("expected the client to be disconnected")
+		}
+		assert.Nil(t, hub.Client(c.ID()))
+		assert.Equal(t, uint64(1), hub.Stats().Disconnected)
+	})
+}
+
+func TestHub_Serve(t *testing.T) {
+	app := coco.NewApp()
+	hub := coco.NewHub(coco.HubOptions{})
+	hub.Publish("news", "missed")
+
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		hub.Serve(res, req, "news")
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var event string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "\n" {
+				return event
+			}
+			event += line
+		}
+	}
+
+	assert.Equal(t, "event: news\nid: 1\ndata: missed\n", readEvent())
+	hub.Publish("news", "live")
+	assert.Equal(t, "event: news\nid: 2\ndata: live\n", readEvent())
+
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Stats().Clients != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, hub.Stats().Clients)
+}
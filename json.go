@@ -0,0 +1,277 @@
+package coco
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONCodec marshals and unmarshals JSON. Set one as the "json codec"
+// setting to replace encoding/json in Response.JSON and Body.JSON.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONReplacer transforms values before they are sent, like the replacer
+// argument of JavaScript’s JSON.stringify. It is called for the top-level
+// value with an empty key, then for every object member and array element in
+// document order. Objects are passed as map[string]interface{}, arrays as
+// []interface{} and numbers as json.Number. Returning false drops the member.
+type JSONReplacer func(key string, value interface{}) (interface{}, bool)
+
+// jsonSettings holds the "json spaces", "json escape", "json replacer" and
+// "json codec" settings in effect for a request.
+type jsonSettings struct {
+	indent   string
+	escape   bool
+	replacer JSONReplacer
+	codec    JSONCodec
+}
+
+func newJSONSettings(setting func(key string) interface{}) jsonSettings {
+	s := jsonSettings{escape: true}
+
+	switch spaces := setting("json spaces").(type) {
+	case int:
+		if spaces > 0 {
+			s.indent = strings.Repeat(" ", spaces)
+		}
+	case string:
+		s.indent = spaces
+	}
+
+	if escape, ok := setting("json escape").(bool); ok {
+		s.escape = escape
+	}
+
+	switch replacer := setting("json replacer").(type) {
+	case JSONReplacer:
+		s.replacer = replacer
+	case func(string, interface{}) (interface{}, bool):
+		s.replacer = replacer
+	}
+
+	if codec, ok := setting("json codec").(JSONCodec); ok {
+		s.codec = codec
+	}
+	return s
+}
+
+// jsonSettings returns the JSON settings in effect for the request.
+func (req *Request) jsonSettings() jsonSettings {
+	if req == nil {
+		return newJSONSettings(func(string) interface{} { return nil })
+	}
+	return newJSONSettings(req.setting)
+}
+
+func (s jsonSettings) marshal(v interface{}) ([]byte, error) {
+	if s.replacer != nil {
+		b, err := s.marshalCodec(v)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		tree, err := decodeOrdered(dec)
+		if err != nil {
+			return nil, err
+		}
+		v, _ = applyReplacer(s.replacer, "", tree)
+		return s.encode(v)
+	}
+
+	if s.codec == nil {
+		return s.encode(v)
+	}
+
+	b, err := s.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if s.escape {
+		var buf bytes.Buffer
+		json.HTMLEscape(&buf, b)
+		b = buf.Bytes()
+	}
+	if s.indent != "" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, b, "", s.indent); err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	}
+	return b, nil
+}
+
+func (s jsonSettings) marshalCodec(v interface{}) ([]byte, error) {
+	if s.codec != nil {
+		return s.codec.Marshal(v)
+	}
+	return json.Marshal(v)
+}
+
+// encode marshals v with encoding/json, honouring the indent and escape
+// settings, without the trailing newline json.Encoder adds.
+func (s jsonSettings) encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(s.escape)
+	enc.SetIndent("", s.indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (s jsonSettings) unmarshal(data []byte, v interface{}) error {
+	if s.codec != nil {
+		return s.codec.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// orderedObject is a decoded JSON object that keeps its member order.
+type orderedObject []orderedMember
+
+type orderedMember struct {
+	key   string
+	value interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// Members are written unescaped; the outer encoder applies the
+		// "json escape" setting to the whole document.
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(m.key); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		if err := enc.Encode(m.value); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o orderedObject) generic() map[string]interface{} {
+	m := make(map[string]interface{}, len(o))
+	for _, member := range o {
+		m[member.key] = genericJSON(member.value)
+	}
+	return m
+}
+
+func genericJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case orderedObject:
+		return t.generic()
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = genericJSON(e)
+		}
+		return out
+	}
+	return v
+}
+
+// decodeOrdered decodes the next JSON value, keeping object member order.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := orderedObject{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedMember{key: keyTok.(string), value: value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	default:
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+}
+
+// applyReplacer walks the decoded value calling replacer. Containers the
+// replacer hands back unchanged are walked further so their members keep
+// their order; anything else it returns is used as-is.
+func applyReplacer(replacer JSONReplacer, key string, v interface{}) (interface{}, bool) {
+	g := genericJSON(v)
+	out, keep := replacer(key, g)
+	if !keep {
+		return nil, false
+	}
+	if !sameContainer(out, g) {
+		return out, true
+	}
+
+	switch t := v.(type) {
+	case orderedObject:
+		obj := orderedObject{}
+		for _, m := range t {
+			if value, keep := applyReplacer(replacer, m.key, m.value); keep {
+				obj = append(obj, orderedMember{key: m.key, value: value})
+			}
+		}
+		return obj, true
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, e := range t {
+			arr[i], _ = applyReplacer(replacer, strconv.Itoa(i), e)
+		}
+		return arr, true
+	}
+	return out, true
+}
+
+// sameContainer reports whether a and b are the same map or slice.
+func sameContainer(a, b interface{}) bool {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if av.Kind() != bv.Kind() {
+		return false
+	}
+	switch av.Kind() {
+	case reflect.Map, reflect.Slice:
+		return av.Pointer() == bv.Pointer() && av.Len() == bv.Len()
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package coco_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	return []byte(strings.ToUpper(strings.TrimSpace(sb.String()))), err
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal([]byte(strings.ToLower(string(data))), v)
+}
+
+type jsonUser struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Bio      string `json:"bio"`
+}
+
+func TestResponseJSON_Settings(t *testing.T) {
+	user := jsonUser{Name: "ada", Password: "secret", Bio: "<b>hi</b>"}
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		expected string
+	}{
+		{"defaults", nil, `{"name":"ada","password":"secret","bio":"\u003cb\u003ehi\u003c/b\u003e"}`},
+		{"json escape disabled", map[string]interface{}{"json escape": false}, `{"name":"ada","password":"secret","bio":"<b>hi</b>"}`},
+		{"json spaces", map[string]interface{}{"json spaces": 2, "json escape": false}, "{\n  \"name\": \"ada\",\n  \"password\": \"secret\",\n  \"bio\": \"<b>hi</b>\"\n}"},
+		{"json replacer", map[string]interface{}{"json escape": false, "json replacer": coco.JSONReplacer(func(key string, value interface{}) (interface{}, bool) {
+			if key == "password" {
+				return nil, false
+			}
+			if s, ok := value.(string); ok {
+				return strings.ToUpper(s), true
+			}
+			return value, true
+		})}, `{"name":"ADA","bio":"<B>HI</B>"}`},
+		{"json codec", map[string]interface{}{"json codec": upperCodec{}}, `{"NAME":"ADA","PASSWORD":"SECRET","BIO":"\u003cB\u003eHI\u003c/B\u003e"}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := coco.NewApp()
+			for k, v := range tc.settings {
+				app.SetSetting(k, v)
+			}
+			app.Get("/user", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+				res.JSON(user)
+			})
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/user", nil))
+
+			assert.Equal(t, tc.expected, w.Body.String())
+		})
+	}
+}
+
+func TestRouteSettings_JSON(t *testing.T) {
+	app := coco.NewApp()
+	app.SetSetting("json spaces", 4)
+
+	api := app.NewRouter("api")
+	api.SetSetting("json spaces", 0)
+	v1 := api.NewRouter("v1")
+
+	handler := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.JSON(map[string]int{"a": 1})
+	}
+	app.Get("/pretty", handler)
+	v1.Get("/compact", handler)
+
+	assert.Equal(t, 0, v1.GetSetting("json spaces"))
+	assert.Equal(t, "development", v1.GetSetting("env"))
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/pretty", nil))
+	assert.Equal(t, "{\n    \"a\": 1\n}", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/compact", nil))
+	assert.Equal(t, `{"a":1}`, w.Body.String())
+}
+
+func TestBodyJSON_Codec(t *testing.T) {
+	app := coco.NewApp()
+	app.SetSetting("json codec", upperCodec{})
+
+	app.Post("/echo", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		var data map[string]string
+		if err := req.Body.JSON(&data); err != nil {
+			res.Status(http.StatusBadRequest).Send(err.Error())
+			return
+		}
+		res.Send(data["name"])
+	})
+	app.Post("/decode", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		var data map[string]string
+		if err := req.Body.Decode(&data); err != nil {
+			res.Status(http.StatusBadRequest).Send(err.Error())
+			return
+		}
+		res.Send(data["name"])
+	})
+
+	tests := []struct{ path, contentType string }{
+		{"/echo", "application/json"},
+		{"/decode", "application/json"},
+		{"/decode", "application/vnd.api+json"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(`{"NAME":"ADA"}`))
+		req.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		assert.Equal(t, "ada", w.Body.String(), tc.path+" "+tc.contentType)
+	}
+}
@@ -0,0 +1,254 @@
+package coco
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptSpec is a single entry of an Accept* header.
+type acceptSpec struct {
+	value  string
+	params map[string]string
+	q      float64
+	index  int
+}
+
+// acceptMatch records how well an offer satisfied the header.
+type acceptMatch struct {
+	offer       string
+	index       int
+	q           float64
+	specificity int
+	specIndex   int
+}
+
+// parseAccept splits an Accept* header into its entries and their q-values.
+// Entries whose q-value cannot be parsed are ignored, per RFC 7231.
+func parseAccept(header string) []acceptSpec {
+	var specs []acceptSpec
+	for i, part := range splitHeader(header) {
+		fields := strings.Split(part, ";")
+		spec := acceptSpec{
+			value: strings.ToLower(strings.TrimSpace(fields[0])),
+			q:     1,
+			index: i,
+		}
+		if spec.value == "" {
+			continue
+		}
+
+		valid := true
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			val := ""
+			if len(kv) == 2 {
+				val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			if key == "q" {
+				q, err := strconv.ParseFloat(val, 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				spec.q = q
+				continue
+			}
+			if spec.params == nil {
+				spec.params = make(map[string]string)
+			}
+			spec.params[key] = strings.ToLower(val)
+		}
+
+		if valid {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// splitHeader splits a comma separated header, respecting quoted strings.
+func splitHeader(header string) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(header); i++ {
+		switch header[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, header[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, header[start:])
+}
+
+// negotiate returns the offers acceptable to specs, best first. The
+// specificity function scores how closely a spec matches an offer, returning
+// -1 when it does not match at all.
+func negotiate(specs []acceptSpec, offers []string, specificity func(spec acceptSpec, offer string) int) []string {
+	var matches []acceptMatch
+	for i, offer := range offers {
+		best := acceptMatch{offer: offer, index: i, specificity: -1}
+		for _, spec := range specs {
+			s := specificity(spec, offer)
+			if s < 0 {
+				continue
+			}
+			if s > best.specificity || (s == best.specificity && spec.q > best.q) {
+				best.q, best.specificity, best.specIndex = spec.q, s, spec.index
+			}
+		}
+		if best.specificity >= 0 && best.q > 0 {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.q != b.q {
+			return a.q > b.q
+		}
+		if a.specificity != b.specificity {
+			return a.specificity > b.specificity
+		}
+		if a.specIndex != b.specIndex {
+			return a.specIndex < b.specIndex
+		}
+		return a.index < b.index
+	})
+
+	result := make([]string, len(matches))
+	for i, m := range matches {
+		result[i] = m.offer
+	}
+	return result
+}
+
+// normalizeType expands shorthand types such as "json" or "html" into full
+// media types, leaving anything containing a slash or starting with "+"
+// untouched.
+func normalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "" || strings.Contains(t, "/") || strings.HasPrefix(t, "+") {
+		return t
+	}
+	switch t {
+	case "json":
+		return "application/json"
+	case "html":
+		return "text/html"
+	case "xml":
+		return "application/xml"
+	case "text":
+		return "text/plain"
+	case "urlencoded":
+		return "application/x-www-form-urlencoded"
+	case "multipart":
+		return "multipart/*"
+	}
+	if mt := mime.TypeByExtension("." + t); mt != "" {
+		if parsed, _, err := mime.ParseMediaType(mt); err == nil {
+			return parsed
+		}
+	}
+	return ""
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	parts := strings.SplitN(mediaType, "/", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// mediaTypeSpecificity scores an Accept entry against an offered media type.
+func mediaTypeSpecificity(spec acceptSpec, offer string) int {
+	mediaType, params, err := mime.ParseMediaType(offer)
+	if err != nil {
+		return -1
+	}
+	offerType, offerSub := splitMediaType(mediaType)
+	specType, specSub := splitMediaType(spec.value)
+
+	s := 0
+	if specType == offerType {
+		s |= 4
+	} else if specType != "*" {
+		return -1
+	}
+	if specSub == offerSub {
+		s |= 2
+	} else if specSub != "*" {
+		return -1
+	}
+
+	if len(spec.params) > 0 {
+		for k, v := range spec.params {
+			if !strings.EqualFold(params[k], v) {
+				return -1
+			}
+		}
+		s |= 1
+	}
+	return s
+}
+
+// tokenSpecificity scores Accept-Charset and Accept-Encoding entries.
+func tokenSpecificity(spec acceptSpec, offer string) int {
+	switch {
+	case spec.value == strings.ToLower(offer):
+		return 1
+	case spec.value == "*":
+		return 0
+	}
+	return -1
+}
+
+// languageSpecificity scores Accept-Language entries, letting "en" match
+// "en-US" and the other way round.
+func languageSpecificity(spec acceptSpec, offer string) int {
+	offer = strings.ToLower(offer)
+	offerPrefix := strings.SplitN(offer, "-", 2)[0]
+	specPrefix := strings.SplitN(spec.value, "-", 2)[0]
+
+	switch {
+	case spec.value == offer:
+		return 4
+	case specPrefix == offer:
+		return 2
+	case spec.value == offerPrefix:
+		return 1
+	case spec.value == "*":
+		return 0
+	}
+	return -1
+}
+
+// typeMatches reports whether mediaType satisfies pattern, where pattern may
+// use "*" for either part or a "+suffix" to match structured syntax suffixes.
+func typeMatches(pattern, mediaType string) bool {
+	if pattern == "" || mediaType == "" {
+		return false
+	}
+	mediaType = strings.ToLower(mediaType)
+	typ, sub := splitMediaType(mediaType)
+
+	if strings.HasPrefix(pattern, "+") {
+		return strings.HasSuffix(sub, pattern)
+	}
+
+	patternType, patternSub := splitMediaType(pattern)
+	if patternType != "*" && patternType != typ {
+		return false
+	}
+	if strings.HasPrefix(patternSub, "*+") {
+		return strings.HasSuffix(sub, patternSub[1:])
+	}
+	return patternSub == "*" || patternSub == sub
+}
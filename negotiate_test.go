@@ -0,0 +1,30 @@
+package coco
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseAccept(t *testing.T) {
+	specs := parseAccept(`text/html;level="1,2";q=0.7, application/json, text/plain;q=abc, */*;q=0.1`)
+
+	if len(specs) != 3 {
+		t.Fatalf("Expected 3 valid specs, got %d: %+v", len(specs), specs)
+	}
+	assert.Equal(t, "text/html", specs[0].value)
+	assert.Equal(t, "1,2", specs[0].params["level"])
+	assert.Equal(t, 0.7, specs[0].q)
+	assert.Equal(t, "application/json", specs[1].value)
+	assert.Equal(t, 1.0, specs[1].q)
+	assert.Equal(t, "*/*", specs[2].value)
+}
+
+func Test_normalizeType(t *testing.T) {
+	assert.Equal(t, "application/json", normalizeType("json"))
+	assert.Equal(t, "text/html", normalizeType("HTML"))
+	assert.Equal(t, "image/png", normalizeType("png"))
+	assert.Equal(t, "+json", normalizeType("+json"))
+	assert.Equal(t, "text/*", normalizeType("text/*"))
+	assert.Equal(t, "", normalizeType("nonsense-type"))
+}
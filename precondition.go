@@ -0,0 +1,114 @@
+package coco
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckPreconditions evaluates the request’s If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since headers against the current ETag and
+// modification time of the resource, in the order given by RFC 7232,
+// section 6. An empty etag falls back to the ETag already set on the
+// response, such as one from ETagFor; without one, If-Match always fails.
+// A zero lastModified skips the date conditions.
+//
+// It reports whether the request may proceed. Otherwise it has already
+// answered with 412 Precondition Failed, or 304 Not Modified for GET and
+// HEAD requests whose cached copy is current.
+func (r *Response) CheckPreconditions(etag string, lastModified time.Time) bool {
+	if etag == "" {
+		etag = r.Get("ETag")
+	}
+	lastModified = lastModified.Truncate(time.Second)
+
+	req := r.request()
+	header := req.r.Header
+	safe := req.r.Method == http.MethodGet || req.r.Method == http.MethodHead
+
+	if ifMatch := header.Get("If-Match"); ifMatch != "" {
+		if !etagMatches(ifMatch, etag, false) {
+			return r.preconditionFailed()
+		}
+	} else if since, err := http.ParseTime(header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return r.preconditionFailed()
+		}
+	}
+
+	if ifNoneMatch := header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag, true) {
+			if safe {
+				return r.notModified(etag, lastModified)
+			}
+			return r.preconditionFailed()
+		}
+	} else if since, err := http.ParseTime(header.Get("If-Modified-Since")); err == nil && safe && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return r.notModified(etag, lastModified)
+		}
+	}
+
+	return true
+}
+
+func (r *Response) preconditionFailed() bool {
+	r.SendStatus(http.StatusPreconditionFailed)
+	return false
+}
+
+func (r *Response) notModified(etag string, lastModified time.Time) bool {
+	if etag != "" {
+		r.Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		r.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	r.ww.Header().Del("Content-Type")
+	r.ww.WriteHeader(http.StatusNotModified)
+	return false
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// matches etag, using weak comparison when weak is set and strong
+// comparison otherwise. "*" matches any current representation.
+func etagMatches(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range splitHeader(header) {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePreconditions returns a Handler that answers 428 Precondition
+// Required to requests using one of methods, PUT, PATCH and DELETE by
+// default, that carry neither If-Match nor If-Unmodified-Since. This makes
+// clients opt into optimistic concurrency instead of overwriting blindly.
+func RequirePreconditions(methods ...string) Handler {
+	if len(methods) == 0 {
+		methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	return func(res Response, req *Request, next NextFunc) {
+		for _, m := range methods {
+			if strings.EqualFold(req.Method, m) && req.Get("If-Match") == "" && req.Get("If-Unmodified-Since") == "" {
+				res.SendStatus(http.StatusPreconditionRequired)
+				return
+			}
+		}
+		next(res, req)
+	}
+}
@@ -0,0 +1,131 @@
+package coco_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func TestResponse_CheckPreconditions(t *testing.T) {
+	app := coco.NewApp()
+
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		if res.CheckPreconditions(`"v2"`, modified) {
+			res.Send("ok")
+		}
+	}
+	app.Get("/doc", handler)
+	app.Put("/doc", handler)
+	app.Patch("/generated", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("ETag", coco.StrongETag([]byte("body")))
+		if res.CheckPreconditions("", time.Time{}) {
+			res.Send("ok")
+		}
+	})
+
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"no conditions", "PUT", nil, http.StatusOK},
+		{"if-match current", "PUT", map[string]string{"If-Match": `"v1", "v2"`}, http.StatusOK},
+		{"if-match stale", "PUT", map[string]string{"If-Match": `"v1"`}, http.StatusPreconditionFailed},
+		{"if-match weak", "PUT", map[string]string{"If-Match": `W/"v2"`}, http.StatusPreconditionFailed},
+		{"if-match any", "PUT", map[string]string{"If-Match": "*"}, http.StatusOK},
+		{"if-unmodified-since ok", "PUT", map[string]string{"If-Unmodified-Since": after}, http.StatusOK},
+		{"if-unmodified-since failed", "PUT", map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"if-match wins over date", "PUT", map[string]string{"If-Match": `"v2"`, "If-Unmodified-Since": before}, http.StatusOK},
+		{"if-none-match write", "PUT", map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"if-none-match read", "GET", map[string]string{"If-None-Match": `W/"v2"`}, http.StatusNotModified},
+		{"if-none-match other", "GET", map[string]string{"If-None-Match": `"v1"`}, http.StatusOK},
+		{"if-modified-since current", "GET", map[string]string{"If-Modified-Since": after}, http.StatusNotModified},
+		{"if-modified-since stale", "GET", map[string]string{"If-Modified-Since": before}, http.StatusOK},
+		{"if-modified-since ignored for writes", "PUT", map[string]string{"If-Modified-Since": after}, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, _ := doRequest(t, app, tc.method, "/doc", tc.headers)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == http.StatusNotModified {
+				assert.Equal(t, `"v2"`, resp.Header.Get("ETag"))
+				assert.Equal(t, modified.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+			}
+		})
+	}
+
+	t.Run("it should use the ETag set on the response", func(t *testing.T) {
+		resp, _ := doRequest(t, app, "PATCH", "/generated", map[string]string{"If-Match": coco.StrongETag([]byte("body"))})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, _ = doRequest(t, app, "PATCH", "/generated", map[string]string{"If-Match": coco.StrongETag([]byte("old"))})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	})
+}
+
+func TestResponse_ETagFor(t *testing.T) {
+	app := coco.NewApp()
+
+	doc := []byte("version 1")
+	app.Get("/doc", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("ETag", res.ETagFor(doc)).Send(doc)
+	})
+	app.Get("/weak", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(doc)
+	})
+	app.Put("/doc", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		if res.CheckPreconditions(res.ETagFor(doc), time.Time{}) {
+			doc = []byte("version 2")
+			res.Send("ok")
+		}
+	})
+
+	resp, _ := doRequest(t, app, "GET", "/weak", nil)
+	weak := resp.Header.Get("ETag")
+	assert.Equal(t, coco.WeakETag(doc), weak, "ETags are weak by default")
+
+	resp, _ = doRequest(t, app, "PUT", "/doc", map[string]string{"If-Match": weak})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "weak ETags never satisfy If-Match")
+
+	resp, _ = doRequest(t, app, "GET", "/doc", nil)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, coco.StrongETag([]byte("version 1")), etag)
+
+	resp, _ = doRequest(t, app, "GET", "/doc", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = doRequest(t, app, "PUT", "/doc", map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = doRequest(t, app, "PUT", "/doc", map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "the document has changed")
+}
+
+func TestRequirePreconditions(t *testing.T) {
+	app := coco.NewApp()
+	app.Use(coco.RequirePreconditions())
+
+	ok := func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send("ok")
+	}
+	app.Get("/doc", ok)
+	app.Put("/doc", ok)
+
+	resp, _ := doRequest(t, app, "PUT", "/doc", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, _ = doRequest(t, app, "PUT", "/doc", map[string]string{"If-Match": `"v1"`})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = doRequest(t, app, "GET", "/doc", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
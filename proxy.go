@@ -0,0 +1,157 @@
+package coco
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// TrustFunc decides whether the proxy at addr, hop hops away from the
+// server, is trusted to report the previous address in X-Forwarded-For.
+// The socket address is hop 0.
+type TrustFunc func(addr string, hop int) bool
+
+// trustRanges are the named ranges accepted by the "trust proxy" setting.
+var trustRanges = map[string][]string{
+	"loopback":    {"127.0.0.1/8", "::1/128"},
+	"linklocal":   {"169.254.0.0/16", "fe80::/10"},
+	"uniquelocal": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+}
+
+// compileTrust turns a "trust proxy" setting into a TrustFunc, or nil when
+// no proxy is trusted. The setting may be:
+//   - a bool, trusting every proxy or none;
+//   - an integer of any kind, trusting that many hops from the server;
+//   - a string of comma separated addresses, CIDR ranges or the named
+//     ranges "loopback", "linklocal" and "uniquelocal", or a []string of
+//     them;
+//   - a TrustFunc, or a func with the same signature.
+func compileTrust(setting interface{}) (TrustFunc, error) {
+	switch v := setting.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return func(string, int) bool { return true }, nil
+	case string:
+		return compileTrustList(strings.Split(v, ","))
+	case []string:
+		return compileTrustList(v)
+	case TrustFunc:
+		return v, nil
+	case func(addr string, hop int) bool:
+		return v, nil
+	}
+
+	var hops int64
+	switch rv := reflect.ValueOf(setting); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		hops = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		hops = math.MaxInt64
+		if u := rv.Uint(); u < math.MaxInt64 {
+			hops = int64(u)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported trust proxy setting of type %T", setting)
+	}
+	if hops <= 0 {
+		return nil, nil
+	}
+	return func(_ string, hop int) bool { return int64(hop) < hops }, nil
+}
+
+func compileTrustList(entries []string) (TrustFunc, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		ranges, ok := trustRanges[entry]
+		if !ok {
+			ranges = []string{entry}
+		}
+		for _, r := range ranges {
+			n, err := parseTrustRange(r)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, n)
+		}
+	}
+	if len(nets) == 0 {
+		return nil, nil
+	}
+
+	return func(addr string, _ int) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseTrustRange parses an address or CIDR range.
+func parseTrustRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust proxy range %q", s)
+		}
+		return n, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trust proxy address %q", s)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// forwardedAddrs returns the addresses the request passed through, from the
+// socket address back towards the client, stopping after the first address
+// reported by an untrusted proxy.
+func forwardedAddrs(socketAddr string, header http.Header, trust TrustFunc) []string {
+	addrs := []string{socketAddr}
+	if trust == nil {
+		return addrs
+	}
+
+	forwarded := parseXForwardedFor(strings.Join(header.Values("X-Forwarded-For"), ","))
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if !trust(addrs[len(addrs)-1], len(addrs)-1) {
+			break
+		}
+		if forwarded[i] == "" {
+			continue
+		}
+		addrs = append(addrs, forwarded[i])
+	}
+	return addrs
+}
+
+// firstHeaderValue returns the first entry of a comma separated header.
+func firstHeaderValue(header http.Header, key string) string {
+	value := header.Get(key)
+	if idx := strings.IndexByte(value, ','); idx != -1 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
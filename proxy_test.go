@@ -0,0 +1,169 @@
+package coco_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+type proxyInfo struct {
+	Ip       string
+	Ips      []string
+	Protocol string
+	Secure   bool
+	HostName string
+}
+
+func requestThroughProxy(t *testing.T, trust interface{}, remoteAddr string, headers map[string]string) proxyInfo {
+	t.Helper()
+
+	app := coco.NewApp()
+	app.SetSetting("trust proxy", trust)
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.JSON(proxyInfo{req.Ip, req.Ips, req.Protocol, req.Secure, req.HostName})
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "http://app.internal:8080/", nil)
+	r.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+
+	var info proxyInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	return info
+}
+
+func TestTrustProxy(t *testing.T) {
+	forwarded := map[string]string{
+		"X-Forwarded-For":   "203.0.113.7, 10.0.0.2, 10.0.0.1",
+		"X-Forwarded-Proto": "HTTPS",
+		"X-Forwarded-Host":  "shop.example.com:443, cdn.internal",
+	}
+
+	tests := []struct {
+		name   string
+		trust  interface{}
+		remote string
+		want   proxyInfo
+	}{
+		{
+			name:   "disabled",
+			trust:  false,
+			remote: "127.0.0.1:5000",
+			want:   proxyInfo{Ip: "127.0.0.1", Ips: []string{}, Protocol: "http", HostName: "app.internal"},
+		},
+		{
+			name:   "trust all",
+			trust:  true,
+			remote: "127.0.0.1:5000",
+			want: proxyInfo{
+				Ip: "203.0.113.7", Ips: []string{"203.0.113.7", "10.0.0.2", "10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+		{
+			name:   "hop count",
+			trust:  2,
+			remote: "127.0.0.1:5000",
+			want: proxyInfo{
+				Ip: "10.0.0.2", Ips: []string{"10.0.0.2", "10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+		{
+			name:   "hop count of another integer type",
+			trust:  uint16(2),
+			remote: "127.0.0.1:5000",
+			want: proxyInfo{
+				Ip: "10.0.0.2", Ips: []string{"10.0.0.2", "10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+		{
+			name:   "named ranges",
+			trust:  "loopback, uniquelocal",
+			remote: "127.0.0.1:5000",
+			want: proxyInfo{
+				Ip: "203.0.113.7", Ips: []string{"203.0.113.7", "10.0.0.2", "10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+		{
+			name:   "CIDR list stops at the first untrusted proxy",
+			trust:  []string{"127.0.0.1", "10.0.0.1/32"},
+			remote: "127.0.0.1:5000",
+			want: proxyInfo{
+				Ip: "10.0.0.2", Ips: []string{"10.0.0.2", "10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+		{
+			name:   "untrusted socket",
+			trust:  "loopback",
+			remote: "198.51.100.9:5000",
+			want:   proxyInfo{Ip: "198.51.100.9", Ips: []string{}, Protocol: "http", HostName: "app.internal"},
+		},
+		{
+			name: "function",
+			trust: func(addr string, hop int) bool {
+				return addr == "::1"
+			},
+			remote: "[::1]:5000",
+			want: proxyInfo{
+				Ip: "10.0.0.1", Ips: []string{"10.0.0.1"},
+				Protocol: "https", Secure: true, HostName: "shop.example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, requestThroughProxy(t, tt.trust, tt.remote, forwarded))
+		})
+	}
+}
+
+func TestTrustProxy_TLS(t *testing.T) {
+	app := coco.NewApp()
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(req.Protocol)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	r.TLS = &tls.ConnectionState{}
+	r.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	assert.Equal(t, "https", w.Body.String(), "untrusted headers cannot downgrade the protocol")
+}
+
+func TestTrustProxy_Setting(t *testing.T) {
+	app := coco.NewApp()
+	assert.False(t, app.IsTrustProxyEnabled())
+
+	app.SetSetting("trust proxy", "loopback")
+	assert.True(t, app.IsTrustProxyEnabled())
+
+	app.SetSetting("trust proxy", 0)
+	assert.False(t, app.IsTrustProxyEnabled())
+
+	for _, hops := range []interface{}{int64(1), uint(2), int32(3), uint8(4)} {
+		app.SetSetting("trust proxy", hops)
+		assert.True(t, app.IsTrustProxyEnabled(), "%T hop counts", hops)
+	}
+	app.SetSetting("trust proxy", int64(-1))
+	assert.False(t, app.IsTrustProxyEnabled())
+
+	assert.Panics(t, func() { app.SetSetting("trust proxy", "10.0.0.0/33") })
+	assert.Panics(t, func() { app.SetSetting("trust proxy", "not-an-address") })
+	assert.Panics(t, func() { app.SetSetting("trust proxy", 1.5) })
+	assert.Panics(t, func() { app.NewRouter("/api").SetSetting("trust proxy", true) }, "routers cannot change who is trusted")
+}
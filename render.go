@@ -1,10 +1,12 @@
 package coco
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
-
-	"github.com/noelukwa/tempest"
+	"path"
+	"sort"
+	"strings"
 )
 
 // TemplateConfig is a configuration for loading templates from an fs.FS
@@ -18,28 +20,164 @@ type TemplateConfig struct {
 	IncludesDir string
 
 	// The name used for layout templates :- templates that wrap other contents.
-	// Defaults to "layouts".
+	// Defaults to "layout".
 	Layout string
+
+	// Funcs are added to every template, alongside coco's own functions:
+	// flashes, csrfToken, csrfField and cspNonce.
+	Funcs template.FuncMap
 }
 
-// LoadTemplates loads templates from an fs.FS with a given config
+// LoadTemplates loads templates from an fs.FS with a given config.
+//
+// Every file with the template extension becomes a template keyed by its
+// path without the top-level directory and the extension, so
+// views/admin/index.html is rendered as "admin/index". Each one is parsed
+// together with the includes directories and layout files found in its own
+// directory and the directories above it, and executed through the layout.
+// Only files with the template extension are layouts. A parse error in any
+// page, layout or include is returned, and the templates loaded before are
+// kept.
 func (a *App) LoadTemplates(fs fs.FS, config *TemplateConfig) (err error) {
+	conf := TemplateConfig{Ext: ".html", IncludesDir: "includes", Layout: "layout"}
+	if config != nil {
+		if config.Ext != "" {
+			conf.Ext = config.Ext
+		}
+		if config.IncludesDir != "" {
+			conf.IncludesDir = config.IncludesDir
+		}
+		if config.Layout != "" {
+			conf.Layout = config.Layout
+		}
+		conf.Funcs = config.Funcs
+	}
 
-	if a.templates == nil {
-		a.templates = make(map[string]*template.Template)
+	funcs := template.FuncMap{}
+	for name, fn := range conf.Funcs {
+		funcs[name] = fn
+	}
+	for name, fn := range requestTemplateFuncs(nil) {
+		funcs[name] = fn
 	}
 
-	var tmpst *tempest.Tempest
-	if config != nil {
-		tmpst = tempest.WithConfig(&tempest.Config{
-			Layout:      config.Layout,
-			IncludesDir: config.IncludesDir,
-			Ext:         config.Ext,
-		})
-	} else {
-		tmpst = tempest.New()
+	templates, err := parseTemplates(fs, conf, funcs)
+	if err != nil {
+		return err
+	}
+	a.templates = templates
+	return nil
+}
+
+func parseTemplates(fsys fs.FS, conf TemplateConfig, funcs template.FuncMap) (map[string]*template.Template, error) {
+	layoutFile := conf.Layout + conf.Ext
+
+	var includes, layouts, pages []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != "." && path.Base(p) == conf.IncludesDir {
+				includes = append(includes, p)
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case path.Base(p) == layoutFile:
+			layouts = append(layouts, p)
+		case path.Ext(p) == conf.Ext:
+			pages = append(pages, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Outer directories first, so that nested layouts and includes override
+	// the definitions above them.
+	sort.SliceStable(includes, func(i, j int) bool { return len(includes[i]) < len(includes[j]) })
+	sort.SliceStable(layouts, func(i, j int) bool { return len(layouts[i]) < len(layouts[j]) })
+
+	templates := make(map[string]*template.Template, len(pages))
+	for _, page := range pages {
+		// Pages without a layout are executed on their own.
+		files := append(inTemplateScope(page, layouts), page)
+		tmpl := template.New(path.Base(files[0])).Funcs(funcs)
+
+		for _, dir := range inTemplateScope(page, includes) {
+			files, err := fs.Glob(fsys, path.Join(dir, "*"+conf.Ext))
+			if err != nil {
+				return nil, fmt.Errorf("error getting includes: %w", err)
+			}
+			if len(files) == 0 {
+				continue
+			}
+			if tmpl, err = tmpl.ParseFS(fsys, files...); err != nil {
+				return nil, fmt.Errorf("error parsing includes: %w", err)
+			}
+		}
+
+		if tmpl, err = tmpl.ParseFS(fsys, files...); err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %w", page, err)
+		}
+
+		// views/admin/index.html -> admin/index
+		key := strings.TrimPrefix(page, strings.Split(page, "/")[0]+"/")
+		key = strings.TrimSuffix(key, path.Ext(key))
+		templates[key] = tmpl
+	}
+	return templates, nil
+}
+
+// inTemplateScope returns the includes directories or layout files that
+// apply to page: those next to it or in a directory above it.
+func inTemplateScope(page string, paths []string) []string {
+	scoped := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if dir := path.Dir(p); dir == "." || strings.HasPrefix(page, dir+"/") {
+			scoped = append(scoped, p)
+		}
+	}
+	return scoped
+}
+
+// requestTemplateFuncs returns the functions coco provides to templates,
+// bound to the response being rendered. With a nil response they are the
+// placeholders templates are parsed with.
+func requestTemplateFuncs(r *Response) template.FuncMap {
+	var req *Request
+	if r != nil {
+		req = r.request()
 	}
 
-	a.templates, err = tmpst.LoadFS(fs)
-	return err
+	return template.FuncMap{
+		"flashes": func(kinds ...string) []Flash {
+			if req == nil {
+				return nil
+			}
+			return req.Flashes(kinds...)
+		},
+		"csrfToken": func() string {
+			if req == nil {
+				return ""
+			}
+			return req.CSRFToken()
+		},
+		"csrfField": func() template.HTML {
+			if req == nil {
+				return ""
+			}
+			return req.csrfField()
+		},
+		"cspNonce": func() string {
+			if req == nil {
+				return ""
+			}
+			return req.CSPNonce()
+		},
+	}
 }
@@ -1,10 +1,14 @@
 package coco
 
 import (
+	"bytes"
+	"html/template"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestLoadTemplates(t *testing.T) {
@@ -62,6 +66,79 @@ func TestLoadTemplates(t *testing.T) {
 
 }
 
+func TestLoadTemplates_Nested(t *testing.T) {
+	views := fstest.MapFS{
+		"views/layout.html":          {Data: []byte(`<main>{{template "header" .}}{{block "content" .}}{{end}}</main>`)},
+		"views/includes/header.html": {Data: []byte(`{{define "header"}}{{shout "coco"}}{{end}}`)},
+		"views/index.html":           {Data: []byte(`{{define "content"}}home{{end}}`)},
+		"views/dash/layout.html":     {Data: []byte(`<dash>{{template "header" .}}{{block "content" .}}{{end}}</dash>`)},
+		"views/dash/index.html":      {Data: []byte(`{{define "content"}}dash{{end}}`)},
+	}
+
+	app := NewApp()
+	err := app.LoadTemplates(views, &TemplateConfig{
+		Funcs: template.FuncMap{"shout": strings.ToUpper},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	tests := map[string]string{
+		"index":      "<main>COCOhome</main>",
+		"dash/index": "<dash>COCOdash</dash>",
+	}
+	for name, want := range tests {
+		tmpl := app.templates[name]
+		if tmpl == nil {
+			t.Fatalf("Expected %s to be loaded, but it was not", name)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatalf("Executing %s: %v", name, err)
+		}
+		if buf.String() != want {
+			t.Errorf("Expected %s to render %q, got %q", name, want, buf.String())
+		}
+	}
+
+	views["views/broken.html"] = &fstest.MapFile{Data: []byte(`{{if}}`)}
+	if err := app.LoadTemplates(views, nil); err == nil {
+		t.Error("Expected a parse error, but got none")
+	}
+}
+
+func TestLoadTemplates_Strict(t *testing.T) {
+	views := fstest.MapFS{
+		"views/layout.txt": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+		"views/index.html": {Data: []byte(`{{define "content"}}home{{end}}page`)},
+	}
+
+	app := NewApp()
+	if err := app.LoadTemplates(views, nil); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := app.templates["index"].Execute(&buf, nil); err != nil {
+		t.Fatalf("Executing index: %v", err)
+	}
+	if buf.String() != "page" {
+		t.Errorf("Expected files without the template extension not to be layouts, got %q", buf.String())
+	}
+
+	views["views/layout.html"] = &fstest.MapFile{Data: []byte(`<main>{{block "content" .}}</main>`)}
+	err := app.LoadTemplates(views, nil)
+	if err == nil {
+		t.Fatal("Expected a broken layout to fail, but got no error")
+	}
+	if !strings.Contains(err.Error(), "views/index.html") {
+		t.Errorf("Expected the error to name the page being parsed, got %v", err)
+	}
+	if app.templates["index"] == nil {
+		t.Error("Expected the previously loaded templates to be kept")
+	}
+}
+
 // NewTestFS creates a fs.FS from the given directory path.
 func NewTestFS(dirPath string) fs.FS {
 	return os.DirFS(dirPath)
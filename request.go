@@ -2,16 +2,17 @@ package coco
 
 import (
 	coreContext "context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-http-utils/fresh"
 	"github.com/julienschmidt/httprouter"
@@ -34,20 +35,34 @@ type Range struct {
 }
 
 type Request struct {
-	r *http.Request
+	r        *http.Request
+	w        http.ResponseWriter
+	app      *App
+	route    *route
+	session  *Session
+	flash    *flashes
+	csrf     *csrfState
+	cspNonce string
+	streams  []*EventStream
 
 	BaseURL string
 
-	// HostName contains the hostname derived from the Host HTTP header.
+	// HostName contains the hostname derived from the Host HTTP header, or
+	// X-Forwarded-Host when the request came through a trusted proxy.
 	HostName string
 
-	// Ip contains the remote IP address of the request.
+	// Ip contains the remote IP address of the request: the socket address,
+	// or the furthest address in X-Forwarded-For reached through trusted
+	// proxies when the "trust proxy" setting is enabled.
 	Ip string
 
-	// Ips contains the remote IP addresses from the X-Forwarded-For header.
+	// Ips contains the addresses from the X-Forwarded-For header reported
+	// by trusted proxies, from the client to the nearest proxy.
 	Ips []string
 
-	// Protocol contains the request protocol string: "http" or "https"
+	// Protocol contains the request protocol string: "http" or "https",
+	// taken from X-Forwarded-Proto when the request came through a trusted
+	// proxy.
 	Protocol string
 
 	// Secure is a boolean that is true if the request protocol is "https"
@@ -75,15 +90,11 @@ type Request struct {
 	// Params contains the Route parameters.
 	Params map[string]string
 
-	// SignedCookies contains the signed cookies sent by the request.
+	// SignedCookies contains the signed cookies sent by the request whose
+	// signature matches one of the App's cookie secrets, without the
+	// signature. Tampered cookies are dropped.
 	SignedCookies map[string]string
 
-	// Stale is a boolean that is true if the request is stale, false otherwise.
-	Stale bool
-
-	// Fresh is a boolean that is true if the request is fresh, false otherwise.
-	Fresh bool
-
 	// Method contains a string corresponding to the HTTP method of the request:
 	// GET, POST, PUT, and so on.
 	Method string
@@ -93,16 +104,45 @@ type Request struct {
 }
 
 type Body struct {
-	req *http.Request
+	req        *http.Request
+	app        *App
+	route      *route
+	buf        *bodyBuffer
+	decompress *DecompressOptions
 }
 
 func newRequest(r *http.Request, w http.ResponseWriter, params httprouter.Params, app *App) (*Request, error) {
-	hostName, err := parseHostName(r.Host)
+	socketIP, err := parseIP(r.RemoteAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	ip, err := parseIP(r.RemoteAddr)
+	// X-Forwarded-* headers are only believed when the socket peer is a
+	// trusted proxy, and X-Forwarded-For only as far as proxies are trusted.
+	trust := app.trust()
+	trusted := trust != nil && trust(socketIP, 0)
+	addrs := forwardedAddrs(socketIP, r.Header, trust)
+
+	ips := make([]string, 0, len(addrs)-1)
+	for i := len(addrs) - 1; i > 0; i-- {
+		ips = append(ips, addrs[i])
+	}
+
+	protocol := "http"
+	if r.TLS != nil {
+		protocol = "https"
+	}
+	host := r.Host
+	if trusted {
+		if proto := firstHeaderValue(r.Header, "X-Forwarded-Proto"); proto != "" {
+			protocol = strings.ToLower(proto)
+		}
+		if forwardedHost := firstHeaderValue(r.Header, "X-Forwarded-Host"); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	hostName, err := parseHostName(host)
 	if err != nil {
 		return nil, err
 	}
@@ -110,30 +150,28 @@ func newRequest(r *http.Request, w http.ResponseWriter, params httprouter.Params
 	xhr := isXhr(r.Header.Get("X-Requested-With"))
 
 	domainOffset := app.settings["subdomain offset"].(int)
+	cookies, signedCookies := parseCookies(r.Cookies(), app.secrets())
 
 	req := &Request{
-		BaseURL:     filepath.Dir(r.URL.Path),
-		HostName:    hostName,
-		Ip:          ip,
-		Ips:         []string{},
-		Protocol:    r.Proto,
-		Secure:      r.TLS != nil,
-		Xhr:         xhr,
-		OriginalURL: r.URL,
-		Cookies:     parseCookies(r.Cookies()),
-		Query:       parseQuery(r.URL.Query()),
-		Params:      parseParams(params),
-		Method:      r.Method,
-		Body:        Body{r},
-		r:           r,
-		Path:        r.URL.Path,
-		Stale:       !checkFreshness(r, w),
-		Fresh:       checkFreshness(r, w),
-		Subdomains:  parseSubdomains(hostName, domainOffset),
-	}
-
-	if app.IsTrustProxyEnabled() {
-		req.Ips = parseXForwardedFor(r.Header.Get("X-Forwarded-For"))
+		BaseURL:       filepath.Dir(r.URL.Path),
+		HostName:      hostName,
+		Ip:            addrs[len(addrs)-1],
+		Ips:           ips,
+		Protocol:      protocol,
+		Secure:        protocol == "https",
+		Xhr:           xhr,
+		OriginalURL:   r.URL,
+		Cookies:       cookies,
+		SignedCookies: signedCookies,
+		Query:         parseQuery(r.URL.Query()),
+		Params:        parseParams(params),
+		Method:        r.Method,
+		Body:          Body{req: r, app: app},
+		r:             r,
+		w:             w,
+		app:           app,
+		Path:          r.URL.Path,
+		Subdomains:    parseSubdomains(hostName, domainOffset),
 	}
 
 	return req, nil
@@ -160,6 +198,11 @@ func parseXForwardedFor(header string) []string {
 }
 
 func parseHostName(host string) (string, error) {
+	if strings.HasPrefix(host, "[") {
+		if idx := strings.Index(host, "]"); idx != -1 {
+			return host[1:idx], nil
+		}
+	}
 	if idx := strings.Index(host, ":"); idx != -1 {
 		return host[:idx], nil
 	}
@@ -167,8 +210,8 @@ func parseHostName(host string) (string, error) {
 }
 
 func parseIP(remoteAddr string) (string, error) {
-	if idx := strings.LastIndex(remoteAddr, ":"); idx != -1 {
-		return remoteAddr[:idx], nil
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host, nil
 	}
 	return remoteAddr, nil
 }
@@ -177,14 +220,6 @@ func isXhr(xRequestedWith string) bool {
 	return strings.EqualFold(xRequestedWith, "XMLHttpRequest")
 }
 
-func parseCookies(cookies []*http.Cookie) map[string]string {
-	cookieMap := make(map[string]string)
-	for _, cookie := range cookies {
-		cookieMap[cookie.Name] = cookie.Value
-	}
-	return cookieMap
-}
-
 func parseQuery(query url.Values) map[string]string {
 	queryMap := make(map[string]string)
 	for key, values := range query {
@@ -201,11 +236,32 @@ func parseParams(params httprouter.Params) map[string]string {
 	return paramMap
 }
 
-func checkFreshness(req *http.Request, w http.ResponseWriter) bool {
-	if req.Method != "GET" && req.Method != "HEAD" {
+// IsFresh reports whether the client’s cached copy is still valid, judged
+// by its If-None-Match and If-Modified-Since headers against the ETag and
+// Last-Modified headers set on the response so far. Only GET and HEAD
+// requests with a 2xx or 304 response status can be fresh.
+func (req *Request) IsFresh() bool {
+	if req.r.Method != "GET" && req.r.Method != "HEAD" {
+		return false
+	}
+
+	status, header := http.StatusOK, http.Header{}
+	if req.w != nil {
+		header = req.w.Header()
+		if ww, ok := req.w.(*wrappedWriter); ok && ww._statusCode() != 0 {
+			status = ww._statusCode()
+		}
+	}
+	if (status < 200 || status >= 300) && status != http.StatusNotModified {
 		return false
 	}
-	return fresh.IsFresh(req.Header, w.Header())
+	return fresh.IsFresh(req.r.Header, header)
+}
+
+// IsStale reports whether the client’s cached copy is out of date. It is the
+// opposite of IsFresh.
+func (req *Request) IsStale() bool {
+	return !req.IsFresh()
 }
 
 // JSONError is an error type that is returned when the request body is not a valid JSON.
@@ -231,16 +287,27 @@ func (body *Body) JSON(dest interface{}) error {
 		return JSONError{http.StatusUnsupportedMediaType, "Unsupported media type, expected 'application/json'"}
 	}
 
-	bdy, err := io.ReadAll(body.req.Body)
+	rc, err := body.reader()
+	if err != nil {
+		if e, ok := err.(Error); ok {
+			return JSONError{e.Code, e.Message}
+		}
+		return JSONError{http.StatusBadRequest, "Error decoding JSON payload: " + err.Error()}
+	}
+
+	bdy, err := io.ReadAll(rc)
 	if err != nil {
+		if e, ok := err.(Error); ok {
+			return JSONError{e.Code, e.Message}
+		}
 		return JSONError{http.StatusBadRequest, "Error reading JSON payload: " + err.Error()}
 	}
 
-	if err := body.req.Body.Close(); err != nil {
+	if err := rc.Close(); err != nil {
 		return JSONError{http.StatusInternalServerError, "Error closing request body: " + err.Error()}
 	}
 
-	if err := json.Unmarshal(bdy, dest); err != nil {
+	if err := newJSONSettings(body.setting).unmarshal(bdy, dest); err != nil {
 		return JSONError{http.StatusBadRequest, "Error unmarshalling JSON: " + err.Error()}
 	}
 
@@ -249,12 +316,17 @@ func (body *Body) JSON(dest interface{}) error {
 
 // Text returns the request body as a string.
 func (body *Body) Text() (string, error) {
-	b, err := io.ReadAll(body.req.Body)
+	rc, err := body.reader()
+	if err != nil {
+		return "", fmt.Errorf("error decoding text payload: %w", err)
+	}
+
+	b, err := io.ReadAll(rc)
 	if err != nil {
 		return "", fmt.Errorf("error reading text payload: %w", err)
 	}
 
-	if err := body.req.Body.Close(); err != nil {
+	if err := rc.Close(); err != nil {
 		return "", fmt.Errorf("error closing request body: %w", err)
 	}
 
@@ -263,10 +335,9 @@ func (body *Body) Text() (string, error) {
 
 // FormData returns the body form data, expects request sent with `x-www-form-urlencoded` header or
 func (body *Body) FormData() (map[string][]string, error) {
-	if body.req.Body == nil {
+	if body.req.Body == nil && body.buf == nil {
 		return nil, errors.New("request body is nil")
 	}
-	defer body.req.Body.Close()
 
 	contentType, _, err := mime.ParseMediaType(body.req.Header.Get("Content-Type"))
 	if err != nil {
@@ -277,6 +348,23 @@ func (body *Body) FormData() (map[string][]string, error) {
 		return nil, fmt.Errorf("unsupported Content-Type: %s", contentType)
 	}
 
+	if body.req.PostForm == nil {
+		rc, err := body.reader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode form data: %w", err)
+		}
+		defer rc.Close()
+
+		values, err := readForm(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse form data: %w", err)
+		}
+		if body.req.PostForm, err = decodeFormCharset(values, body.req.Header.Get("Content-Type"), body.strictCharset()); err != nil {
+			return nil, fmt.Errorf("failed to decode form data: %w", err)
+		}
+	}
+
+	// PostForm is set, so ParseForm only merges in the URL query.
 	if err := body.req.ParseForm(); err != nil {
 		return nil, fmt.Errorf("failed to parse form data: %w", err)
 	}
@@ -290,8 +378,20 @@ func (body *Body) FormData() (map[string][]string, error) {
 	return data, nil
 }
 
+// setting resolves a setting for the route handling the body's request.
+func (body *Body) setting(key string) interface{} {
+	return lookupSetting(body.route, body.app, key)
+}
+
+// setting resolves a setting for the route handling the request.
+func (req *Request) setting(key string) interface{} {
+	return lookupSetting(req.route, req.app, key)
+}
+
+// IsTrustProxyEnabled reports whether the "trust proxy" setting trusts any
+// proxy.
 func (a *App) IsTrustProxyEnabled() bool {
-	return a.settings["trust proxy"].(bool)
+	return a.trust() != nil
 }
 
 func (req *Request) Cookie(name string) (value string, exists bool) {
@@ -299,6 +399,22 @@ func (req *Request) Cookie(name string) (value string, exists bool) {
 	return value, exists
 }
 
+// EncryptedCookie returns the decrypted value of a cookie set with
+// Response.EncryptedCookie. It returns http.ErrNoCookie when the cookie is
+// missing, ErrCookieInvalid when it cannot be decrypted with any of the
+// App's cookie keys and ErrCookieExpired when its embedded expiry has passed.
+func (req *Request) EncryptedCookie(name string) (string, error) {
+	keys := req.app.cookieAEADs()
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	cookie, err := req.r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return decryptCookieValue(keys, name, cookie.Value, time.Now())
+}
+
 // GetParam returns the value of param `name` when present or `defaultValue`.
 func (req *Request) GetParam(name string) string {
 	if value, ok := req.Params[name]; ok {
@@ -329,32 +445,26 @@ func (req *Request) QueryParam(name string) string {
 }
 
 // Is returns true if the incoming request’s “Content-Type” HTTP header field
-// matches the given mime type.
-func (req *Request) Is(mime string) bool {
+// matches any of the given mime types. Types may be shorthand such as "json"
+// or "html", use "*" wildcards like "text/*", or be a "+json" style suffix.
+// Content-Type parameters such as charset are ignored.
+func (req *Request) Is(types ...string) bool {
 	contentType := req.r.Header.Get("Content-Type")
 	if contentType == "" {
 		return false
 	}
 
-	switch mime {
-	case "json":
-		mime = "application/json"
-	case "html":
-		mime = "text/html"
-	case "xml":
-		mime = "application/xml"
-	case "text":
-		mime = "text/plain"
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
 	}
 
-	mimeParts := strings.Split(mime, "/")
-	ctParts := strings.Split(contentType, "/")
-
-	if mimeParts[1] == "*" {
-		return strings.EqualFold(mimeParts[0], ctParts[0])
+	for _, t := range types {
+		if typeMatches(normalizeType(t), mediaType) {
+			return true
+		}
 	}
-
-	return strings.EqualFold(mime, contentType)
+	return false
 }
 
 // Range returns the first range found in the request’s “Range” header field.
@@ -429,31 +539,96 @@ func (req *Request) SetContext(ctx coreContext.Context) {
 	req.r = req.r.WithContext(ctx)
 }
 
-//// Accepts checks if the specified mine types are acceptable, based on the request’s Accept HTTP header field.
-//// The method returns the best match, or if none of the specified mine types is acceptable, returns "".
-//func (req *Request) Accepts(mime ...string) string {
-//
-//	if len(mime) == 0 {
-//		return ""
-//	}
-//
-//	return ""
-//}
-
-//// AcceptsCharsets returns true if the incoming request’s “Accept-Charset” HTTP header field
-//// includes the given charset.
-//func (req *Request) AcceptsCharsets(charset string) bool {
-//	return false
-//}
-//
-//// AcceptsEncodings returns true if the incoming request’s “Accept-Encoding” HTTP header field
-//// includes the given encoding.
-//func (req *Request) AcceptsEncodings(encoding string) bool {
-//	return false
-//}
-
-//// AcceptsLanguages returns true if the incoming request’s “Accept-Language” HTTP header field
-//// includes the given language.
-//func (req *Request) AcceptsLanguages(lang string) bool {
-//	return false
-//}
+// Accepts checks if the specified mime types are acceptable, based on the request’s Accept HTTP header field.
+// Types may be full mime types or shorthand such as "json" and "html".
+// The method returns the best match as given, or "" if none of the specified mime types is acceptable.
+func (req *Request) Accepts(types ...string) string {
+	if len(types) == 0 {
+		return ""
+	}
+
+	header, ok := req.r.Header["Accept"]
+	if !ok {
+		return types[0]
+	}
+
+	offers := make([]string, 0, len(types))
+	byOffer := make(map[string]string, len(types))
+	for _, t := range types {
+		normalized := normalizeType(t)
+		if normalized == "" {
+			continue
+		}
+		if _, seen := byOffer[normalized]; !seen {
+			byOffer[normalized] = t
+			offers = append(offers, normalized)
+		}
+	}
+
+	best := negotiate(parseAccept(strings.Join(header, ",")), offers, mediaTypeSpecificity)
+	if len(best) == 0 {
+		return ""
+	}
+	return byOffer[best[0]]
+}
+
+// AcceptsCharsets returns the first acceptable charset of the given charsets,
+// based on the request’s “Accept-Charset” HTTP header field, or "" if none is acceptable.
+func (req *Request) AcceptsCharsets(charsets ...string) string {
+	return req.acceptsTokens("Accept-Charset", charsets, tokenSpecificity)
+}
+
+// AcceptsEncodings returns the first acceptable encoding of the given encodings,
+// based on the request’s “Accept-Encoding” HTTP header field, or "" if none is acceptable.
+// The "identity" encoding is acceptable unless explicitly refused.
+func (req *Request) AcceptsEncodings(encodings ...string) string {
+	if len(encodings) == 0 {
+		return ""
+	}
+
+	header, ok := req.r.Header["Accept-Encoding"]
+	if !ok {
+		return encodings[0]
+	}
+
+	specs := parseAccept(strings.Join(header, ","))
+	identity := true
+	for _, spec := range specs {
+		if spec.value == "identity" || spec.value == "*" {
+			identity = false
+			break
+		}
+	}
+	if identity {
+		specs = append(specs, acceptSpec{value: "identity", q: 0.0001, index: len(specs)})
+	}
+
+	best := negotiate(specs, encodings, tokenSpecificity)
+	if len(best) == 0 {
+		return ""
+	}
+	return best[0]
+}
+
+// AcceptsLanguages returns the first acceptable language of the given languages,
+// based on the request’s “Accept-Language” HTTP header field, or "" if none is acceptable.
+func (req *Request) AcceptsLanguages(langs ...string) string {
+	return req.acceptsTokens("Accept-Language", langs, languageSpecificity)
+}
+
+func (req *Request) acceptsTokens(key string, offers []string, specificity func(acceptSpec, string) int) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	header, ok := req.r.Header[http.CanonicalHeaderKey(key)]
+	if !ok {
+		return offers[0]
+	}
+
+	best := negotiate(parseAccept(strings.Join(header, ",")), offers, specificity)
+	if len(best) == 0 {
+		return ""
+	}
+	return best[0]
+}
@@ -266,6 +266,24 @@ func TestBody_FormData(t *testing.T) {
 			t.Errorf("Expected specific error message when parsing form fails, got %v", err)
 		}
 	})
+
+	t.Run("it should reject form bodies over 10MB", func(t *testing.T) {
+		app := NewApp()
+
+		payload := "key=" + strings.Repeat("a", 10<<20)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+
+		request, _ := newRequest(req, w, nil, app)
+
+		_, err := request.Body.FormData()
+		var e Error
+		if !errors.As(err, &e) || e.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected Error with StatusRequestEntityTooLarge, got %v", err)
+		}
+	})
 }
 
 func TestRequest_Cookie(t *testing.T) {
@@ -497,14 +515,12 @@ func Test_newRequest(t *testing.T) {
 					BaseURL:     "/",
 					HostName:    "example.com",
 					Ip:          "192.0.2.1",
-					Protocol:    "HTTP/1.1",
+					Protocol:    "http",
 					Secure:      false,
 					Xhr:         false,
 					OriginalURL: &url.URL{Scheme: "http", Host: "example.com", Path: "/path"},
 					Method:      "GET",
 					Path:        "/path",
-					Fresh:       false,
-					Stale:       true,
 					r:           validRequest,
 					Body:        Body{req: validRequest},
 				}
@@ -538,8 +554,8 @@ func Test_newRequest(t *testing.T) {
 				got.Xhr != expected.Xhr ||
 				got.Method != expected.Method ||
 				got.Path != expected.Path ||
-				got.Fresh != expected.Fresh ||
-				got.Stale != expected.Stale {
+				got.IsFresh() ||
+				!got.IsStale() {
 				t.Errorf("newRequest() fields do not match the expected result")
 			}
 
@@ -568,3 +584,134 @@ func (bc *badCloser) Read(p []byte) (n int, err error) {
 func (bc *badCloser) Close() error {
 	return errors.New("error closing request body")
 }
+
+func TestRequest_IsTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		types       []string
+		expected    bool
+	}{
+		{"application/json; charset=utf-8", []string{"json"}, true},
+		{"application/json; charset=utf-8", []string{"application/json"}, true},
+		{"application/json", []string{"application/*"}, true},
+		{"application/json", []string{"*/json"}, true},
+		{"application/json", []string{"json/*"}, false},
+		{"application/vnd.api+json", []string{"+json"}, true},
+		{"application/vnd.api+json", []string{"application/*+json"}, true},
+		{"text/html; charset=utf-8", []string{"json", "html"}, true},
+		{"text/plain", []string{"text/*"}, true},
+		{"text/plain", []string{"html"}, false},
+		{"", []string{"*/*"}, false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		request := &Request{r: req}
+
+		assert.Equal(t, tc.expected, request.Is(tc.types...), "Is(%v) with Content-Type %q", tc.types, tc.contentType)
+	}
+}
+
+func TestRequest_Accepts(t *testing.T) {
+	tests := []struct {
+		accept   string
+		types    []string
+		expected string
+	}{
+		{"", []string{"json", "html"}, ""},
+		{"text/html", []string{"json", "html"}, "html"},
+		{"application/json, text/html;q=0.5", []string{"html", "json"}, "json"},
+		{"text/*;q=0.5, application/json;q=0.1", []string{"application/json", "text/plain"}, "text/plain"},
+		{"*/*", []string{"json", "html"}, "json"},
+		{"text/*, text/html;q=0", []string{"html", "text"}, "text"},
+		{"application/xml", []string{"json"}, ""},
+		{"text/html;level=1", []string{"text/html"}, ""},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tc.accept)
+		request := &Request{r: req}
+
+		assert.Equal(t, tc.expected, request.Accepts(tc.types...), "Accepts(%v) with Accept %q", tc.types, tc.accept)
+	}
+
+	t.Run("it should return the first type when Accept is missing", func(t *testing.T) {
+		request := &Request{r: httptest.NewRequest("GET", "/", nil)}
+		assert.Equal(t, "html", request.Accepts("html", "json"))
+	})
+}
+
+func TestRequest_AcceptsCharsets(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Charset", "iso-8859-1;q=0.5, utf-8")
+	request := &Request{r: req}
+
+	assert.Equal(t, "utf-8", request.AcceptsCharsets("iso-8859-1", "utf-8"))
+	assert.Equal(t, "iso-8859-1", request.AcceptsCharsets("iso-8859-1"))
+	assert.Equal(t, "", request.AcceptsCharsets("utf-16"))
+}
+
+func TestRequest_AcceptsEncodings(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.8, deflate")
+	request := &Request{r: req}
+
+	assert.Equal(t, "deflate", request.AcceptsEncodings("gzip", "deflate"))
+	assert.Equal(t, "gzip", request.AcceptsEncodings("gzip", "identity"))
+	assert.Equal(t, "identity", request.AcceptsEncodings("br", "identity"))
+
+	req.Header.Set("Accept-Encoding", "gzip, *;q=0")
+	assert.Equal(t, "", request.AcceptsEncodings("br", "identity"))
+}
+
+func TestRequest_AcceptsLanguages(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5")
+	request := &Request{r: req}
+
+	assert.Equal(t, "fr", request.AcceptsLanguages("en", "fr"))
+	assert.Equal(t, "en-US", request.AcceptsLanguages("en-US", "de"))
+	assert.Equal(t, "de", request.AcceptsLanguages("de"))
+}
+
+func TestRequest_IsFresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		etag        string
+		status      int
+		want        bool
+	}{
+		{"matching etag", "GET", `"a"`, `"a"`, 0, true},
+		{"weak comparison", "HEAD", `W/"a"`, `"a"`, http.StatusOK, true},
+		{"different etag", "GET", `"a"`, `"b"`, 0, false},
+		{"no conditional headers", "GET", "", `"a"`, 0, false},
+		{"not modified status", "GET", `"a"`, `"a"`, http.StatusNotModified, true},
+		{"error status", "GET", `"a"`, `"a"`, http.StatusNotFound, false},
+		{"unsafe method", "POST", `"a"`, `"a"`, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/", nil)
+			if tc.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			ww := wrapWriter(httptest.NewRecorder())
+			req, err := newRequest(r, ww, httprouter.Params{}, NewApp())
+			assert.NoError(t, err)
+
+			// Freshness follows headers and status set after the request was created.
+			ww.Header().Set("ETag", tc.etag)
+			ww.statusCode = tc.status
+
+			assert.Equal(t, tc.want, req.IsFresh())
+			assert.Equal(t, !tc.want, req.IsStale())
+		})
+	}
+}
@@ -2,10 +2,7 @@ package coco
 
 import (
 	"bufio"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
@@ -43,11 +40,12 @@ var (
 	ErrDotfilesDeny = errors.New("serving dotfiles is not allowed")
 )
 
-// func (r *Response) setContentType(contentType string) {
-// 	if cty := r.ww.Header().Get("Content-Type"); cty == "" {
-// 		r.ww.Header().Set("Content-Type", contentType)
-// 	}
-// }
+// setContentType sets the Content-Type header unless a handler already chose one.
+func (r *Response) setContentType(contentType string) {
+	if cty := r.ww.Header().Get("Content-Type"); cty == "" {
+		r.Set("Content-Type", contentType)
+	}
+}
 
 type wrappedWriter struct {
 	http.ResponseWriter
@@ -55,6 +53,7 @@ type wrappedWriter struct {
 	statusCodeWritten bool
 	hijacker          http.Hijacker
 	flusher           http.Flusher
+	beforeWrite       []func()
 }
 
 func wrapWriter(original http.ResponseWriter) *wrappedWriter {
@@ -72,10 +71,21 @@ func (w *wrappedWriter) WriteHeader(code int) {
 	if !w.statusCodeWritten {
 		w.statusCodeWritten = true
 		w.statusCode = code
+		hooks := w.beforeWrite
+		w.beforeWrite = nil
+		for _, hook := range hooks {
+			hook()
+		}
 		w.ResponseWriter.WriteHeader(code)
 	}
 }
 
+// onBeforeWrite registers fn to run just before the headers are written,
+// while they can still be changed.
+func (w *wrappedWriter) onBeforeWrite(fn func()) {
+	w.beforeWrite = append(w.beforeWrite, fn)
+}
+
 func (w *wrappedWriter) Write(b []byte) (int, error) {
 	if !w.statusCodeWritten {
 		if w.statusCode == 0 {
@@ -144,15 +154,44 @@ func (r *Response) Cookie(cookie *http.Cookie) *Response {
 	return r
 }
 
-// SignedCookie SecureCookie sets a signed cookie
-func (r *Response) SignedCookie(cookie *http.Cookie, secret string) *Response {
-	mac := hmac.New(sha256.New, []byte(secret))
-	_, _ = mac.Write([]byte(cookie.Value))
-	signature := mac.Sum(nil)
-	encodedSignature := base64.StdEncoding.EncodeToString(signature)
-	cookie.Value = fmt.Sprintf("%s.%s", encodedSignature, cookie.Value)
-	http.SetCookie(r.ww, cookie)
-	return r
+// SignedCookie sets a cookie signed with the first of the App's cookie
+// secrets, which arrives in Request.SignedCookies on later requests. It
+// returns ErrNoCookieSecrets if no secrets have been set.
+func (r *Response) SignedCookie(cookie *http.Cookie) error {
+	secrets := r.app().secrets()
+	if len(secrets) == 0 {
+		return ErrNoCookieSecrets
+	}
+
+	signed := *cookie
+	signed.Value = signCookieValue(cookie.Value, secrets[0])
+	http.SetCookie(r.ww, &signed)
+	return nil
+}
+
+// EncryptedCookie sets a cookie whose value is encrypted and authenticated
+// with AES-GCM under the first of the App's cookie keys. The expiry from
+// MaxAge or Expires is sealed into the value, so Request.EncryptedCookie
+// rejects it afterwards even if the client keeps the cookie. It returns
+// ErrCookieTooLarge if the result would exceed the 4KB cookie limit.
+func (r *Response) EncryptedCookie(cookie *http.Cookie) error {
+	keys := r.app().cookieAEADs()
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+
+	value, err := encryptCookieValue(keys[0], cookie.Name, cookie.Value, cookieExpiry(cookie, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	encrypted := *cookie
+	encrypted.Value = value
+	if len(encrypted.String()) > maxCookieSize {
+		return ErrCookieTooLarge
+	}
+	http.SetCookie(r.ww, &encrypted)
+	return nil
 }
 
 // ClearCookie clears the cookie by setting the MaxAge to -1
@@ -249,43 +288,129 @@ func (r *Response) SendFile(filePath, fileName string, options *DownloadOption,
 }
 
 // JSON sends a JSON response with the given payload.
+// The output honours the "json spaces", "json escape", "json replacer" and
+// "json codec" settings of the route and App.
 func (r *Response) JSON(v interface{}) *Response {
 	r.Set("Content-Type", "application/json; charset=utf-8")
-	jsn, err := json.Marshal(v)
+	jsn, err := r.request().jsonSettings().marshal(v)
 	if err != nil {
 		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
 		return r
 	}
 
-	_, err = r.ww.Write(jsn)
-	if err != nil {
-		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
+	return r.write(jsn)
+}
+
+// JSONP sends a JSON response with JSONP support. The callback is taken from
+// the query parameter named by the "jsonp callback name" setting, which
+// defaults to "callback". Without a callback it behaves like JSON.
+func (r *Response) JSONP(v interface{}) *Response {
+	if jsonpCallback(r.request()) == "" {
+		return r.JSON(v)
 	}
 
-	return r
+	r.Set("Content-Type", "text/javascript; charset=utf-8")
+	r.Set("X-Content-Type-Options", "nosniff")
+	return r.encode(JSONPEncoder, v)
 }
 
 // Send sends the HTTP response.
+// Strings are sent as text/plain and byte slices as-is. Other values are
+// serialised by the encoder registered for the Content-Type when one has
+// been set, otherwise by the registered encoder that best matches the
+// request’s Accept header, JSON by default. A Content-Type set without a
+// matching encoder is kept, and the response fails with 500.
 func (r *Response) Send(body interface{}) *Response {
 	var data []byte
-	var err error
 
 	switch v := body.(type) {
 	case string:
-		r.Set("Content-Type", "text/plain; charset=utf-8")
+		r.setContentType("text/plain; charset=utf-8")
 		data = []byte(v)
 	case []byte:
 		data = v
 	default:
+		return r.sendEncoded(v)
+	}
+
+	return r.write(data)
+}
+
+// write sends body as the response. 2xx responses get an ETag according to
+// the "etag" setting unless one is already set, and fresh GET and HEAD
+// requests are answered with 304 Not Modified instead of the body.
+func (r *Response) write(body []byte) *Response {
+	req := r.request()
+	status := r.statusOrOK()
+
+	if req != nil && status >= 200 && status < 300 && r.Get("ETag") == "" {
+		if generate := etagFunc(req.setting("etag")); generate != nil {
+			if etag := generate(body); etag != "" {
+				r.Set("ETag", etag)
+			}
+		}
+	}
+
+	if req != nil && req.IsFresh() {
+		header := r.ww.Header()
+		for _, key := range []string{"Content-Type", "Content-Length", "Transfer-Encoding"} {
+			header.Del(key)
+		}
+		r.ww.WriteHeader(http.StatusNotModified)
+		return r
+	}
+
+	if _, err := r.ww.Write(body); err != nil {
+		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
+	}
+	return r
+}
+
+func (r *Response) sendEncoded(v interface{}) *Response {
+	app := r.app()
+	if contentType := r.Get("Content-Type"); contentType != "" {
+		enc := app.encoderFor(contentType)
+		if enc == nil {
+			http.Error(r.ww, "no encoder for "+parseMediaType(contentType), http.StatusInternalServerError)
+			return r
+		}
+		return r.encode(enc, v)
+	}
+
+	if app == nil {
 		return r.JSON(v)
 	}
 
-	_, err = r.ww.Write(data)
-	if err != nil {
+	r.Vary("Accept")
+	mediaType, enc := app.negotiateEncoder(r.request())
+	r.Set("Content-Type", mediaType)
+	return r.encode(enc, v)
+}
+
+// encode serialises v with enc before writing anything, so that encoding
+// errors can still be reported as a 500 response.
+func (r *Response) encode(enc Encoder, v interface{}) *Response {
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, r.request(), v); err != nil {
 		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
+		return r
 	}
 
-	return r
+	return r.write(buf.Bytes())
+}
+
+func (r *Response) app() *App {
+	if r.ctx == nil {
+		return nil
+	}
+	return r.ctx.app
+}
+
+func (r *Response) request() *Request {
+	if r.ctx == nil {
+		return nil
+	}
+	return r.ctx.req
 }
 
 // Set sets the specified value to the HTTP response header field.
@@ -365,8 +490,18 @@ func (r *Response) Redirect(path string, status ...int) *Response {
 }
 
 // Type sets the Content-Type HTTP header to the MIME type as determined by the filename’s extension.
+// Values containing a "/" are used as the MIME type as-is.
 func (r *Response) Type(filename string) *Response {
-	mimeType := mime.TypeByExtension(filepath.Ext(filename))
+	if strings.Contains(filename, "/") {
+		r.Set("Content-Type", filename)
+		return r
+	}
+
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = "." + filename
+	}
+	mimeType := mime.TypeByExtension(ext)
 	if mimeType == "" {
 		mimeType = "application/octet-stream"
 	}
@@ -401,7 +536,62 @@ func (r *Response) Vary(field string) *Response {
 	return r
 }
 
+// FormatHandler pairs a media type with the handler that produces it.
+// Type may be a full mime type, shorthand such as "json", or "default" for
+// the handler used when nothing else is acceptable.
+type FormatHandler struct {
+	Type    string
+	Handler Handler
+}
+
+// Format performs content negotiation on the request’s Accept HTTP header and
+// invokes the first handler whose type is the best match, after setting the
+// Content-Type accordingly. Handlers are considered in the order given, which
+// decides the winner when the client accepts several equally.
+// When nothing matches and no "default" handler is given, Format responds
+// with 406 Not Acceptable listing the supported types.
+func (r *Response) Format(handlers ...FormatHandler) *Response {
+	req := r.ctx.req
+	r.Vary("Accept")
+
+	var fallback Handler
+	offers := make([]string, 0, len(handlers))
+	byType := make(map[string]Handler, len(handlers))
+	for _, h := range handlers {
+		if h.Type == "default" {
+			fallback = h.Handler
+			continue
+		}
+		if _, seen := byType[h.Type]; !seen {
+			byType[h.Type] = h.Handler
+			offers = append(offers, h.Type)
+		}
+	}
+
+	if best := req.Accepts(offers...); best != "" {
+		r.Set("Content-Type", normalizeType(best))
+		byType[best](*r, req, r.ctx.next)
+		return r
+	}
+
+	if fallback != nil {
+		fallback(*r, req, r.ctx.next)
+		return r
+	}
+
+	supported := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		supported = append(supported, normalizeType(offer))
+	}
+	r.Status(http.StatusNotAcceptable)
+	r.Send(fmt.Sprintf("Not Acceptable. Supported types: %s", strings.Join(supported, ", ")))
+	return r
+}
+
 // Render renders a template with data and sends a text/html response.
+// Templates can call flashes to read, and consume, the request's flash
+// messages, csrfToken or csrfField when the CSRF middleware is in use, and
+// cspNonce with SecurityHeaders.
 func (r *Response) Render(name string, data interface{}) *Response {
 	tmpl, ok := r.ctx.templates[name]
 	if !ok {
@@ -409,10 +599,20 @@ func (r *Response) Render(name string, data interface{}) *Response {
 		return r
 	}
 
-	r.Set("Content-Type", "text/html; charset=utf-8")
-	err := tmpl.Execute(r.ww, data)
+	// Clone so the request-bound functions, such as flashes, do not leak
+	// between concurrent renders of the same template.
+	tmpl, err := tmpl.Clone()
 	if err != nil {
 		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
+		return r
 	}
-	return r
+
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(requestTemplateFuncs(r)).Execute(&buf, data); err != nil {
+		http.Error(r.ww, err.Error(), http.StatusInternalServerError)
+		return r
+	}
+
+	r.Set("Content-Type", "text/html; charset=utf-8")
+	return r.write(buf.Bytes())
 }
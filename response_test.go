@@ -121,10 +121,13 @@ func TestResponseCookie(t *testing.T) {
 func TestResponseSignedCookie(t *testing.T) {
 	app := coco.NewApp()
 	secret := "secret_key"
+	app.SetCookieSecrets(secret, "old_secret")
 
 	app.Get("/test-signed-cookie", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
 		cookie := &http.Cookie{Name: "signed_test", Value: "signed_value"}
-		res.SignedCookie(cookie, secret)
+		if err := res.SignedCookie(cookie); err != nil {
+			t.Errorf("Failed to set signed cookie: %v", err)
+		}
 	})
 
 	srv := httptest.NewServer(app)
@@ -841,3 +844,73 @@ func TestResponseStatusCode(t *testing.T) {
 		t.Errorf("Expected Content-Type to be 'application/json', got '%s'", cType)
 	}
 }
+
+func TestResponseFormat(t *testing.T) {
+	app := coco.NewApp()
+
+	app.Get("/format", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Format(
+			coco.FormatHandler{Type: "html", Handler: func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+				res.Send("<p>hello</p>")
+			}},
+			coco.FormatHandler{Type: "json", Handler: func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+				res.JSON(map[string]string{"message": "hello"})
+			}},
+		)
+	})
+
+	app.Get("/format-default", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Format(
+			coco.FormatHandler{Type: "json", Handler: func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+				res.JSON(map[string]string{"message": "hello"})
+			}},
+			coco.FormatHandler{Type: "default", Handler: func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+				res.Send("hello")
+			}},
+		)
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	get := func(path, accept string) *http.Response {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		assert.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"html preferred", "/format", "text/html", http.StatusOK, "text/html; charset=utf-8", "<p>hello</p>"},
+		{"json preferred", "/format", "application/json, text/html;q=0.5", http.StatusOK, "application/json; charset=utf-8", `{"message":"hello"}`},
+		{"first handler on wildcard", "/format", "*/*", http.StatusOK, "text/html; charset=utf-8", "<p>hello</p>"},
+		{"not acceptable", "/format", "image/png", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable. Supported types: text/html, application/json"},
+		{"default handler", "/format-default", "image/png", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(tc.path, tc.accept)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.contentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tc.body, string(body))
+			assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+		})
+	}
+}
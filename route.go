@@ -51,6 +51,9 @@ type route struct {
 	cachedMiddleware []Handler
 	rootNode         bool
 	children         map[string]*route
+	settings         map[string]interface{}
+	cors             *corsPolicy
+	headers          http.Header
 }
 
 func (r *route) combineHandlers(handlers ...Handler) []Handler {
@@ -226,6 +229,74 @@ func (r *route) Static(root fs.FS, path string) *route {
 	return r
 }
 
+// SetSetting sets a setting for this router and the routers nested under it,
+// overriding the App setting with the same key.
+//
+// It panics for "trust proxy", which is read before the request is routed
+// and so can only be set on the App.
+func (r *route) SetSetting(key string, value interface{}) *route {
+	if key == "trust proxy" {
+		panic(`coco: the "trust proxy" setting can only be set on the App`)
+	}
+	if r.settings == nil {
+		r.settings = make(map[string]interface{})
+	}
+	r.settings[key] = value
+	return r
+}
+
+// GetSetting retrieves a setting as seen by this router: its own value, else
+// the nearest parent router's, else the App's.
+func (r *route) GetSetting(key string) interface{} {
+	return lookupSetting(r, r.app, key)
+}
+
+// lookupSetting resolves key from rt up through its parents before falling
+// back to the App settings.
+func lookupSetting(rt *route, app *App, key string) interface{} {
+	for current := rt; current != nil; current = current.parent {
+		if value, ok := current.settings[key]; ok {
+			return value
+		}
+	}
+	if app == nil {
+		return nil
+	}
+	return app.GetSetting(key)
+}
+
+// SetDefaultHeader sets a header sent with every response of this router
+// and the routers nested under it, overriding the value set by a parent
+// router. Handlers can still change it with Response.Set. An empty value
+// removes a header inherited from a parent.
+func (r *route) SetDefaultHeader(key, value string) *route {
+	if r.headers == nil {
+		r.headers = make(http.Header)
+	}
+	r.headers.Set(key, value)
+	return r
+}
+
+// defaultHeaders merges the default headers from the root router down to r.
+func (r *route) defaultHeaders() http.Header {
+	var chain []*route
+	for current := r; current != nil; current = current.parent {
+		chain = append(chain, current)
+	}
+
+	headers := make(http.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for key, values := range chain[i].headers {
+			if values[0] == "" {
+				delete(headers, key)
+				continue
+			}
+			headers[key] = values
+		}
+	}
+	return headers
+}
+
 func (r *route) Param(param string, handler ParamHandler) *route {
 
 	if r.paramHandlers == nil {
@@ -0,0 +1,189 @@
+package coco
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CSPNonce is a placeholder source for SecurityOptions.ContentSecurityPolicy
+// that is replaced by the request's nonce, as 'nonce-…'.
+const CSPNonce = "'nonce'"
+
+// DefaultContentSecurityPolicy is the policy sent by SecurityHeaders when
+// none is configured. Scripts are limited to the same origin and inline
+// scripts carrying the request's nonce.
+var DefaultContentSecurityPolicy = map[string][]string{
+	"default-src":               {"'self'"},
+	"base-uri":                  {"'self'"},
+	"font-src":                  {"'self'", "https:", "data:"},
+	"form-action":               {"'self'"},
+	"frame-ancestors":           {"'self'"},
+	"img-src":                   {"'self'", "data:"},
+	"object-src":                {"'none'"},
+	"script-src":                {"'self'", CSPNonce},
+	"script-src-attr":           {"'none'"},
+	"style-src":                 {"'self'", "https:", "'unsafe-inline'"},
+	"upgrade-insecure-requests": nil,
+}
+
+// SecurityOptions configures the SecurityHeaders middleware. Empty fields
+// use the defaults; headers can be left out entirely with Disable.
+type SecurityOptions struct {
+	// ContentSecurityPolicy maps directives to their sources. The CSPNonce
+	// source is replaced by a nonce generated for each request.
+	// Defaults to DefaultContentSecurityPolicy.
+	ContentSecurityPolicy map[string][]string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only,
+	// so that violations are reported but not blocked.
+	CSPReportOnly bool
+
+	// StrictTransportSecurity is the Strict-Transport-Security value.
+	// Defaults to "max-age=31536000; includeSubDomains".
+	StrictTransportSecurity string
+
+	// FrameOptions is the X-Frame-Options value.
+	// Defaults to "SAMEORIGIN".
+	FrameOptions string
+
+	// ReferrerPolicy is the Referrer-Policy value.
+	// Defaults to "no-referrer".
+	ReferrerPolicy string
+
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy value.
+	// Defaults to "same-origin".
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginResourcePolicy is the Cross-Origin-Resource-Policy value.
+	// Defaults to "same-origin".
+	CrossOriginResourcePolicy string
+
+	// CrossOriginEmbedderPolicy is the Cross-Origin-Embedder-Policy value,
+	// such as "require-corp". It is not sent by default, as it blocks
+	// cross-origin resources that do not opt in.
+	CrossOriginEmbedderPolicy string
+
+	// Disable lists headers that are not sent, such as
+	// "Strict-Transport-Security" for sites also served over plain HTTP.
+	Disable []string
+}
+
+// SecurityHeaders returns a Handler that sets security related response
+// headers, in the spirit of helmet: Content-Security-Policy,
+// Strict-Transport-Security, X-Content-Type-Options, X-Frame-Options,
+// Referrer-Policy, the Cross-Origin-*-Policy headers and a few legacy ones.
+// Handlers can still override any of them with Response.Set.
+//
+// When the policy uses CSPNonce, each request gets a fresh nonce, available
+// from Request.CSPNonce and to templates rendered with Response.Render as
+// cspNonce, so inline scripts can be written as
+// <script nonce="{{cspNonce}}">.
+func SecurityHeaders(options *SecurityOptions) Handler {
+	opts := SecurityOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.ContentSecurityPolicy == nil {
+		opts.ContentSecurityPolicy = DefaultContentSecurityPolicy
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if opts.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	csp, nonced := formatCSP(opts.ContentSecurityPolicy)
+
+	headers := [][2]string{
+		{"Strict-Transport-Security", orDefault(opts.StrictTransportSecurity, "max-age=31536000; includeSubDomains")},
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", orDefault(opts.FrameOptions, "SAMEORIGIN")},
+		{"Referrer-Policy", orDefault(opts.ReferrerPolicy, "no-referrer")},
+		{"Cross-Origin-Opener-Policy", orDefault(opts.CrossOriginOpenerPolicy, "same-origin")},
+		{"Cross-Origin-Resource-Policy", orDefault(opts.CrossOriginResourcePolicy, "same-origin")},
+		{"Cross-Origin-Embedder-Policy", opts.CrossOriginEmbedderPolicy},
+		{"Origin-Agent-Cluster", "?1"},
+		{"X-DNS-Prefetch-Control", "off"},
+		{"X-Permitted-Cross-Domain-Policies", "none"},
+		{"X-XSS-Protection", "0"},
+	}
+
+	// Header names are compared canonicalised, as X-DNS-Prefetch-Control
+	// becomes X-Dns-Prefetch-Control.
+	disabled := make(map[string]bool, len(opts.Disable))
+	for _, name := range opts.Disable {
+		disabled[http.CanonicalHeaderKey(name)] = true
+	}
+	isDisabled := func(name string) bool {
+		return disabled[http.CanonicalHeaderKey(name)]
+	}
+	enabled := headers[:0]
+	for _, h := range headers {
+		if h[1] != "" && !isDisabled(h[0]) {
+			enabled = append(enabled, h)
+		}
+	}
+	sendCSP := csp != "" && !isDisabled(cspHeader) && !isDisabled("Content-Security-Policy")
+
+	return func(res Response, req *Request, next NextFunc) {
+		header := res.ww.Header()
+		for _, h := range enabled {
+			header.Set(h[0], h[1])
+		}
+
+		if sendCSP {
+			if nonced {
+				req.cspNonce = newCSPNonce()
+				header.Set(cspHeader, strings.ReplaceAll(csp, CSPNonce, "'nonce-"+req.cspNonce+"'"))
+			} else {
+				header.Set(cspHeader, csp)
+			}
+		}
+		next(res, req)
+	}
+}
+
+// formatCSP serialises a policy with its directives sorted, reporting
+// whether it uses CSPNonce.
+func formatCSP(policy map[string][]string) (csp string, nonced bool) {
+	directives := make([]string, 0, len(policy))
+	for directive := range policy {
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives)
+
+	parts := make([]string, 0, len(directives))
+	for _, directive := range directives {
+		sources := policy[directive]
+		for _, source := range sources {
+			if source == CSPNonce {
+				nonced = true
+			}
+		}
+		parts = append(parts, strings.TrimSpace(directive+" "+strings.Join(sources, " ")))
+	}
+	return strings.Join(parts, "; "), nonced
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("coco: reading random CSP nonce: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// CSPNonce returns the Content-Security-Policy nonce generated for the
+// request by SecurityHeaders, or an empty string when there is none.
+func (req *Request) CSPNonce() string {
+	return req.cspNonce
+}
@@ -0,0 +1,78 @@
+package coco_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	appFS := afero.NewMemMapFs()
+	afero.WriteFile(appFS, "views/page.html", []byte(`<script nonce="{{cspNonce}}">run()</script>`), 0644)
+
+	app := coco.NewApp()
+	assert.NoError(t, app.LoadTemplates(afero.NewIOFS(appFS), nil))
+	app.Use(coco.SecurityHeaders(nil))
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Render("page", nil)
+	})
+	app.Get("/embed", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Set("X-Frame-Options", "DENY")
+		res.Send("ok")
+	})
+
+	resp, body := doRequest(t, app, http.MethodGet, "/", nil)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", resp.Header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "SAMEORIGIN", resp.Header.Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", resp.Header.Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", resp.Header.Get("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, resp.Header.Get("Cross-Origin-Embedder-Policy"))
+
+	csp := resp.Header.Get("Content-Security-Policy")
+	match := regexp.MustCompile(`script-src 'self' 'nonce-([A-Za-z0-9_-]+)';`).FindStringSubmatch(csp)
+	if assert.Len(t, match, 2, csp) {
+		assert.Equal(t, `<script nonce="`+match[1]+`">run()</script>`, body)
+	}
+	assert.Contains(t, csp, "object-src 'none'")
+	assert.Contains(t, csp, "; upgrade-insecure-requests")
+
+	next, _ := doRequest(t, app, http.MethodGet, "/", nil)
+	assert.NotEqual(t, csp, next.Header.Get("Content-Security-Policy"), "nonces are per request")
+
+	resp, _ = doRequest(t, app, http.MethodGet, "/embed", nil)
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"), "handlers can override the headers")
+}
+
+func TestSecurityHeaders_Options(t *testing.T) {
+	app := coco.NewApp()
+	app.Use(coco.SecurityHeaders(&coco.SecurityOptions{
+		ContentSecurityPolicy: map[string][]string{
+			"default-src": {"'self'"},
+			"script-src":  {"'self'", "https://cdn.example.com"},
+		},
+		CSPReportOnly:             true,
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		Disable:                   []string{"strict-transport-security", "X-DNS-Prefetch-Control", "X-XSS-Protection"},
+	}))
+	app.Get("/", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(req.CSPNonce())
+	})
+
+	resp, body := doRequest(t, app, http.MethodGet, "/", nil)
+	assert.Empty(t, body, "no nonce without the placeholder")
+	assert.Empty(t, resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "default-src 'self'; script-src 'self' https://cdn.example.com",
+		resp.Header.Get("Content-Security-Policy-Report-Only"))
+	assert.Equal(t, "strict-origin-when-cross-origin", resp.Header.Get("Referrer-Policy"))
+	assert.Equal(t, "require-corp", resp.Header.Get("Cross-Origin-Embedder-Policy"))
+	assert.Empty(t, resp.Header.Get("Strict-Transport-Security"))
+	assert.Empty(t, resp.Header.Get("X-DNS-Prefetch-Control"))
+	assert.Empty(t, resp.Header.Get("X-XSS-Protection"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+}
@@ -0,0 +1,264 @@
+package coco
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionCookieName = "coco.sid"
+	defaultSessionTTL        = 24 * time.Hour
+)
+
+// SessionOptions configures the Sessions middleware.
+type SessionOptions struct {
+	// Store holds the session data. Defaults to a new MemoryStore.
+	Store Store
+
+	// CookieName is the name of the session cookie. Defaults to "coco.sid".
+	CookieName string
+
+	// TTL is how long a session lives after it was last saved. Defaults to
+	// 24 hours.
+	TTL time.Duration
+
+	// Rolling saves the session and refreshes the cookie on every response,
+	// so that the TTL counts from the last request rather than the last
+	// change.
+	Rolling bool
+
+	// Path, Domain, Secure and SameSite are applied to the session cookie,
+	// which is always HttpOnly. Path defaults to "/".
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Session is the per-client state loaded by the Sessions middleware. It is
+// safe for concurrent use.
+type Session struct {
+	options *SessionOptions
+
+	mu          sync.Mutex
+	id          string
+	token       string
+	values      map[string]interface{}
+	isNew       bool
+	modified    bool
+	destroyed   bool
+	committed   bool
+	cookieToken string
+}
+
+// Sessions returns a Handler that loads the session identified by the
+// request's session cookie, or starts a new one, and makes it available
+// through Request.Session. The session is saved, and its cookie set, just
+// before the response headers are written. New sessions are only saved
+// once a value has been set.
+func Sessions(options *SessionOptions) Handler {
+	opts := SessionOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultSessionCookieName
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultSessionTTL
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+
+	return func(res Response, req *Request, next NextFunc) {
+		s := loadSession(req, &opts)
+		req.session = s
+
+		res.ww.onBeforeWrite(func() { s.commit(res, true) })
+		next(res, req)
+		s.commit(res, !res.ww.statusCodeWritten)
+	}
+}
+
+func loadSession(req *Request, opts *SessionOptions) *Session {
+	s := &Session{options: opts}
+
+	if cookie, err := req.r.Cookie(opts.CookieName); err == nil && cookie.Value != "" {
+		record, err := opts.Store.Load(cookie.Value)
+		if err != nil {
+			log.Printf("coco: loading session: %v", err)
+		}
+		if record != nil {
+			s.id = record.ID
+			s.token = cookie.Value
+			s.cookieToken = cookie.Value
+			s.values = record.Values
+		}
+	}
+
+	if s.id == "" {
+		s.id = newSessionID()
+		s.isNew = true
+	}
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	return s
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("coco: reading random session ID: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Session returns the session loaded by the Sessions middleware, or nil if
+// the middleware is not in use.
+func (req *Request) Session() *Session {
+	return req.session
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Get returns the value stored under key, or nil. Stores that serialise
+// sessions, such as CookieStore and FileStore, return values as decoded
+// by encoding/json.
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revive()
+	s.values[key] = value
+	s.modified = true
+}
+
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// Regenerate moves the session to a new ID, keeping its values, and
+// destroys the old one. Call it when a user logs in so that an ID planted
+// by an attacker before login is worthless afterwards.
+func (s *Session) Regenerate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" {
+		if err := s.options.Store.Destroy(s.token); err != nil {
+			return err
+		}
+	}
+	s.revive()
+	s.id = newSessionID()
+	s.token = ""
+	s.modified = true
+	return nil
+}
+
+// Destroy deletes the session and its values and clears the cookie. Setting
+// a value afterwards starts a new session.
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" {
+		if err := s.options.Store.Destroy(s.token); err != nil {
+			return err
+		}
+	}
+	s.token = ""
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+	s.modified = false
+	return nil
+}
+
+// revive starts a new session after Destroy. s.mu is held.
+func (s *Session) revive() {
+	if s.destroyed {
+		s.destroyed = false
+		s.id = newSessionID()
+		s.isNew = true
+	}
+}
+
+// commit saves the session if it changed, or on every response when
+// Rolling. The cookie is only touched when setCookie is true, as the
+// headers may already have been sent; changes made after that are still
+// saved, but a CookieStore session cannot pick them up.
+func (s *Session) commit(res Response, setCookie bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opts := s.options
+	if s.destroyed {
+		if setCookie && !s.committed && s.cookieToken != "" {
+			http.SetCookie(res.ww, s.cookie("", -1))
+		}
+		s.committed = true
+		return
+	}
+
+	if !s.modified && (s.committed || !opts.Rolling || s.isNew) {
+		return
+	}
+
+	token, err := opts.Store.Save(s.token, &SessionRecord{
+		ID:      s.id,
+		Values:  s.values,
+		Expires: time.Now().Add(opts.TTL),
+	})
+	if err != nil {
+		log.Printf("coco: saving session: %v", err)
+		return
+	}
+	s.token = token
+	s.modified = false
+
+	if setCookie {
+		http.SetCookie(res.ww, s.cookie(token, int(opts.TTL/time.Second)))
+		s.cookieToken = token
+	}
+	s.committed = true
+}
+
+func (s *Session) cookie(value string, maxAge int) *http.Cookie {
+	opts := s.options
+	return &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   maxAge,
+		Secure:   opts.Secure,
+		HttpOnly: true,
+		SameSite: opts.SameSite,
+	}
+}
@@ -0,0 +1,195 @@
+package coco_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func newSessionApp(options *coco.SessionOptions) *coco.App {
+	app := coco.NewApp()
+	app.Use(coco.Sessions(options))
+
+	app.Get("/visit", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		s := req.Session()
+		count, _ := s.Get("count").(float64)
+		if n, ok := s.Get("count").(int); ok {
+			count = float64(n)
+		}
+		s.Set("count", count+1)
+		res.JSON(s.Get("count"))
+	})
+	app.Get("/peek", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		res.Send(req.Session().ID())
+	})
+	app.Post("/login", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		if err := req.Session().Regenerate(); err != nil {
+			res.SendStatus(http.StatusInternalServerError)
+			return
+		}
+		req.Session().Set("user", "ada")
+		res.Send(req.Session().ID())
+	})
+	app.Post("/logout", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		req.Session().Destroy()
+		res.SendStatus(http.StatusNoContent)
+	})
+	return app
+}
+
+func newSessionClient(t *testing.T, app *coco.App) (*http.Client, string) {
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}, srv.URL
+}
+
+func sessionCookie(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == "coco.sid" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	stores := map[string]func() coco.Store{
+		"memory": func() coco.Store { return coco.NewMemoryStore() },
+		"cookie": func() coco.Store { return coco.NewCookieStore("secret") },
+		"file": func() coco.Store {
+			store, err := coco.NewFileStore(afero.NewMemMapFs(), "/sessions")
+			assert.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			client, url := newSessionClient(t, newSessionApp(&coco.SessionOptions{Store: newStore()}))
+
+			resp, err := client.Get(url + "/peek")
+			assert.NoError(t, err)
+			assert.Nil(t, sessionCookie(resp), "empty sessions should not be saved")
+
+			for i := 1; i <= 3; i++ {
+				_, body := getBody(t, client, url+"/visit")
+				assert.Equal(t, []string{"1", "2", "3"}[i-1], body)
+			}
+
+			resp, err = client.Post(url+"/logout", "", nil)
+			assert.NoError(t, err)
+			if c := sessionCookie(resp); assert.NotNil(t, c) {
+				assert.Equal(t, -1, c.MaxAge)
+			}
+
+			_, body := getBody(t, client, url+"/visit")
+			assert.Equal(t, "1", body)
+		})
+	}
+}
+
+func getBody(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf [512]byte
+	n, _ := resp.Body.Read(buf[:])
+	return resp, string(buf[:n])
+}
+
+func TestSession_Regenerate(t *testing.T) {
+	store := coco.NewMemoryStore()
+	client, url := newSessionClient(t, newSessionApp(&coco.SessionOptions{Store: store}))
+
+	getBody(t, client, url+"/visit")
+	_, before := getBody(t, client, url+"/peek")
+
+	resp, err := client.Post(url+"/login", "", nil)
+	assert.NoError(t, err)
+	c := sessionCookie(resp)
+	if !assert.NotNil(t, c) {
+		return
+	}
+	assert.NotEqual(t, before, c.Value)
+
+	record, _ := store.Load(before)
+	assert.Nil(t, record, "the old session should be destroyed")
+	record, _ = store.Load(c.Value)
+	if assert.NotNil(t, record) {
+		assert.Equal(t, "ada", record.Values["user"])
+		assert.Equal(t, 1.0, record.Values["count"])
+	}
+}
+
+func TestSession_Rolling(t *testing.T) {
+	for _, rolling := range []bool{false, true} {
+		client, url := newSessionClient(t, newSessionApp(&coco.SessionOptions{Rolling: rolling, TTL: time.Hour}))
+
+		resp, _ := getBody(t, client, url+"/visit")
+		if c := sessionCookie(resp); assert.NotNil(t, c) {
+			assert.Equal(t, 3600, c.MaxAge)
+			assert.True(t, c.HttpOnly)
+		}
+
+		resp, _ = getBody(t, client, url+"/peek")
+		assert.Equal(t, rolling, sessionCookie(resp) != nil)
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	store := coco.NewMemoryStore()
+	store.Save("", &coco.SessionRecord{ID: "a", Expires: time.Now().Add(-time.Second)})
+	store.Save("", &coco.SessionRecord{ID: "b", Expires: time.Now().Add(time.Hour)})
+
+	record, err := store.Load("a")
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+	assert.Equal(t, 1, store.Len())
+
+	record, _ = store.Load("b")
+	assert.NotNil(t, record)
+}
+
+func TestCookieStore_Tampering(t *testing.T) {
+	store := coco.NewCookieStore("new", "old")
+	token, err := coco.NewCookieStore("old").Save("", &coco.SessionRecord{ID: "a", Values: map[string]interface{}{"k": "v"}})
+	assert.NoError(t, err)
+
+	record, _ := store.Load(token)
+	if assert.NotNil(t, record) {
+		assert.Equal(t, "v", record.Values["k"])
+	}
+
+	record, _ = store.Load(token[:len(token)-2] + "xx")
+	assert.Nil(t, record)
+}
+
+func TestFileStore(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store, err := coco.NewFileStore(fs, "/sessions")
+	assert.NoError(t, err)
+
+	store.Save("", &coco.SessionRecord{ID: "live", Expires: time.Now().Add(time.Hour)})
+	store.Save("", &coco.SessionRecord{ID: "dead", Expires: time.Now().Add(-time.Hour)})
+	afero.WriteFile(fs, "/secret.json", []byte(`{"id":"secret"}`), 0o600)
+
+	record, err := store.Load("../secret")
+	assert.NoError(t, err)
+	assert.Nil(t, record, "tokens must not escape the directory")
+
+	assert.NoError(t, store.Sweep())
+	exists, _ := afero.Exists(fs, "/sessions/dead.json")
+	assert.False(t, exists)
+	record, _ = store.Load("live")
+	assert.NotNil(t, record)
+}
@@ -0,0 +1,228 @@
+package coco
+
+import (
+	"bytes"
+	coreContext "context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSSEHeartbeat = 15 * time.Second
+
+// ErrStreamClosed is returned when writing to an event stream that has been
+// closed, either explicitly or because the client went away.
+var ErrStreamClosed = errors.New("event stream closed")
+
+// EventStream writes Server-Sent Events to a response. It is safe for
+// concurrent use. Create one with Response.SSE.
+type EventStream struct {
+	ww          *wrappedWriter
+	settings    jsonSettings
+	lastEventID string
+
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	heartbeat chan time.Duration
+}
+
+// SSE starts a Server-Sent Events stream on the response. The headers are
+// sent straight away, and a comment is written every 15 seconds, or as
+// configured by the "sse heartbeat" setting (a time.Duration, zero to
+// disable), to keep proxies from timing the connection out.
+//
+// The stream is done when the client disconnects, Close is called or the
+// handler chain returns. Handlers typically defer Close and wait on Done:
+//
+//	stream := res.SSE()
+//	defer stream.Close()
+//	for {
+//		select {
+//		case <-stream.Done():
+//			return
+//		case msg := <-updates:
+//			stream.Send("update", msg.ID, msg)
+//		}
+//	}
+func (r *Response) SSE() *EventStream {
+	req := r.request()
+	s := &EventStream{
+		ww:        r.ww,
+		settings:  req.jsonSettings(),
+		done:      make(chan struct{}),
+		heartbeat: make(chan time.Duration, 1),
+	}
+	s.settings.indent = ""
+
+	interval := defaultSSEHeartbeat
+	if req != nil {
+		req.streams = append(req.streams, s)
+		s.lastEventID = strings.TrimSpace(req.Get("Last-Event-ID"))
+		if d, ok := req.setting("sse heartbeat").(time.Duration); ok {
+			interval = d
+		}
+	}
+
+	r.Set("Content-Type", "text/event-stream")
+	r.Set("Cache-Control", "no-cache")
+	r.Set("X-Accel-Buffering", "no")
+	r.ww.WriteHeader(r.statusOrOK())
+	r.ww.Flush()
+
+	go s.run(r.streamContext(), interval)
+	return s
+}
+
+// run closes the stream when ctx ends and writes heartbeats until then.
+func (s *EventStream) run(ctx coreContext.Context, interval time.Duration) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func(d time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if d > 0 {
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+		}
+	}
+	reset(interval)
+	defer reset(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return
+		case <-s.done:
+			return
+		case d := <-s.heartbeat:
+			reset(d)
+		case <-tick:
+			_ = s.Comment("")
+		}
+	}
+}
+
+// closeStreams closes the event streams opened for the request, so that
+// nothing is written to the response once its handlers have returned.
+func (req *Request) closeStreams() {
+	for _, s := range req.streams {
+		s.Close()
+	}
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client,
+// or an empty string.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel that is closed when the stream ends.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the stream. Nothing more is written after Close returns.
+func (s *EventStream) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// Heartbeat changes the interval between keep-alive comments. Zero disables
+// them.
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	select {
+	case <-s.heartbeat:
+	default:
+	}
+	s.heartbeat <- interval
+}
+
+// Send writes an event. event and id may be empty to omit those fields.
+// Strings and byte slices are sent as-is, split into one data line per line;
+// other values are encoded as JSON with the app’s JSON settings.
+func (s *EventStream) Send(event, id string, data interface{}) error {
+	if strings.ContainsAny(event, "\r\n") {
+		return fmt.Errorf("sse: invalid event name %q", event)
+	}
+	if strings.ContainsAny(id, "\r\n\x00") {
+		return fmt.Errorf("sse: invalid event id %q", id)
+	}
+
+	var payload []byte
+	switch v := data.(type) {
+	case string:
+		payload = []byte(v)
+	case []byte:
+		payload = v
+	default:
+		b, err := s.settings.marshal(v)
+		if err != nil {
+			return err
+		}
+		payload = b
+	}
+
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+	if id != "" {
+		buf.WriteString("id: " + id + "\n")
+	}
+	payload = bytes.ReplaceAll(payload, []byte("\r\n"), []byte("\n"))
+	payload = bytes.ReplaceAll(payload, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n"))
+}
+
+// Comment writes a comment line, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	var buf bytes.Buffer
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	for _, line := range strings.Split(text, "\n") {
+		buf.WriteString(":" + line + "\n")
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+func (s *EventStream) write(b []byte) error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return ErrStreamClosed
+	default:
+	}
+
+	_, err := s.ww.Write(b)
+	if err == nil {
+		s.ww.Flush()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.Close()
+	}
+	return err
+}
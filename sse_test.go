@@ -0,0 +1,131 @@
+package coco_test
+
+import (
+	"bufio"
+	coreContext "context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func TestResponseSSE(t *testing.T) {
+	app := coco.NewApp()
+	app.SetSetting("sse heartbeat", time.Duration(0))
+
+	var lastEventID string
+	var sendErr error
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		stream := res.SSE()
+		lastEventID = stream.LastEventID()
+
+		stream.Retry(3 * time.Second)
+		stream.Send("greeting", "1", "hello\nworld")
+		stream.Send("", "2", map[string]int{"count": 2})
+		stream.Comment("bye")
+		assert.Error(t, stream.Send("bad\nname", "", "x"))
+
+		stream.Close()
+		sendErr = stream.Send("late", "", "x")
+	})
+
+	resp, body := doRequest(t, app, "GET", "/events", map[string]string{"Last-Event-ID": "41"})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "41", lastEventID)
+	assert.Equal(t, "retry: 3000\n\n"+
+		"event: greeting\nid: 1\ndata: hello\ndata: world\n\n"+
+		"id: 2\ndata: {\"count\":2}\n\n"+
+		":bye\n\n", body)
+	assert.True(t, errors.Is(sendErr, coco.ErrStreamClosed))
+}
+
+func TestResponseSSE_Heartbeat(t *testing.T) {
+	app := coco.NewApp()
+	app.SetSetting("sse heartbeat", 5*time.Millisecond)
+
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		stream := res.SSE()
+		defer stream.Close()
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	_, body := doRequest(t, app, "GET", "/events", nil)
+
+	assert.True(t, strings.HasPrefix(body, ":\n\n"), "expected heartbeat comments, got %q", body)
+}
+
+func TestResponseSSE_Disconnect(t *testing.T) {
+	app := coco.NewApp()
+
+	done := make(chan struct{})
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		stream := res.SSE()
+		defer stream.Close()
+		stream.Send("", "", "ready")
+
+		<-stream.Done()
+		close(done)
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ctx, cancel := coreContext.WithCancel(coreContext.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: ready\n", line)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not closed after the client disconnected")
+	}
+}
+
+func TestResponseSSE_HandlerReturns(t *testing.T) {
+	app := coco.NewApp()
+	app.SetSetting("sse heartbeat", time.Microsecond)
+
+	streams := make(chan *coco.EventStream, 20)
+	app.Get("/events", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		stream := res.SSE()
+		stream.Send("", "", "ready")
+		streams <- stream
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	for i := 0; i < cap(streams); i++ {
+		resp, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "data: ready\n", line)
+
+		select {
+		case <-(<-streams).Done():
+		case <-time.After(2 * time.Second):
+			t.Fatal("stream was not closed when the handler returned")
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package coco
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const memoryStoreSweepInterval = time.Minute
+
+// SessionRecord is a session as held by a Store.
+type SessionRecord struct {
+	ID      string                 `json:"id"`
+	Values  map[string]interface{} `json:"values"`
+	Expires time.Time              `json:"expires"`
+}
+
+func (r *SessionRecord) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// Store persists sessions for the Sessions middleware. A token is what the
+// session cookie holds: the session ID for server-side stores, or the
+// session itself for CookieStore.
+type Store interface {
+	// Load returns the session for token, or nil if it is unknown or has
+	// expired.
+	Load(token string) (*SessionRecord, error)
+
+	// Save stores record and returns the token for the session cookie.
+	// token is empty for sessions that have not been saved before.
+	Save(token string, record *SessionRecord) (string, error)
+
+	// Destroy deletes the session for token.
+	Destroy(token string) error
+}
+
+// MemoryStore keeps sessions in memory, evicting them once they expire.
+// Sessions are lost when the process exits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]SessionRecord
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]SessionRecord), lastSweep: time.Now()}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(token string) (*SessionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.sessions[token]
+	if !ok {
+		return nil, nil
+	}
+	if record.expired(time.Now()) {
+		delete(m.sessions, token)
+		return nil, nil
+	}
+	record.Values = copyValues(record.Values)
+	return &record, nil
+}
+
+// Save implements Store.
+func (m *MemoryStore) Save(token string, record *SessionRecord) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= memoryStoreSweepInterval {
+		for id, r := range m.sessions {
+			if r.expired(now) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	stored := *record
+	stored.Values = copyValues(record.Values)
+	m.sessions[record.ID] = stored
+	return record.ID, nil
+}
+
+// Destroy implements Store.
+func (m *MemoryStore) Destroy(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones that
+// have not been evicted yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+// CookieStore keeps the whole session in the signed session cookie, so no
+// server-side state is needed. Values are visible to the client and must
+// fit the 4KB cookie limit. Destroyed sessions cannot be revoked before they
+// expire, as the client may have kept a copy.
+type CookieStore struct {
+	secrets []string
+}
+
+// NewCookieStore creates a CookieStore signing sessions with the first
+// secret and accepting any of them, like App.SetCookieSecrets.
+func NewCookieStore(secrets ...string) *CookieStore {
+	return &CookieStore{secrets: secrets}
+}
+
+// Load implements Store.
+func (c *CookieStore) Load(token string) (*SessionRecord, error) {
+	value, _, valid := unsignCookieValue(token, c.secrets)
+	if !valid {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil
+	}
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, nil
+	}
+	if record.expired(time.Now()) {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// Save implements Store.
+func (c *CookieStore) Save(token string, record *SessionRecord) (string, error) {
+	if len(c.secrets) == 0 {
+		return "", errors.New("cookie store requires a secret")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	token = signCookieValue(base64.RawURLEncoding.EncodeToString(data), c.secrets[0])
+	if len(token) > maxCookieSize {
+		return "", ErrCookieTooLarge
+	}
+	return token, nil
+}
+
+// Destroy implements Store. The cookie is cleared by the middleware.
+func (c *CookieStore) Destroy(token string) error {
+	return nil
+}
+
+// sessionIDPattern matches the IDs generated for sessions, which FileStore
+// uses as file names.
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FileStore keeps each session as a JSON file in a directory of an afero
+// filesystem, such as afero.NewOsFs().
+type FileStore struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewFileStore creates a FileStore writing to dir, which is created if
+// needed.
+func NewFileStore(fs afero.Fs, dir string) (*FileStore, error) {
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{fs: fs, dir: dir}, nil
+}
+
+func (f *FileStore) path(token string) (string, bool) {
+	if !sessionIDPattern.MatchString(token) {
+		return "", false
+	}
+	return filepath.Join(f.dir, token+".json"), true
+}
+
+// Load implements Store.
+func (f *FileStore) Load(token string) (*SessionRecord, error) {
+	p, ok := f.path(token)
+	if !ok {
+		return nil, nil
+	}
+	data, err := afero.ReadFile(f.fs, p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.expired(time.Now()) {
+		return nil, f.Destroy(token)
+	}
+	return &record, nil
+}
+
+// Save implements Store.
+func (f *FileStore) Save(token string, record *SessionRecord) (string, error) {
+	p, ok := f.path(record.ID)
+	if !ok {
+		return "", errors.New("invalid session ID")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	tmp := p + ".tmp"
+	if err := afero.WriteFile(f.fs, tmp, data, 0o600); err != nil {
+		return "", err
+	}
+	if err := f.fs.Rename(tmp, p); err != nil {
+		return "", err
+	}
+	return record.ID, nil
+}
+
+// Destroy implements Store.
+func (f *FileStore) Destroy(token string) error {
+	p, ok := f.path(token)
+	if !ok {
+		return nil
+	}
+	if err := f.fs.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Sweep removes the files of expired sessions. Call it periodically, as
+// expired sessions are otherwise only removed when they are loaded.
+func (f *FileStore) Sweep() error {
+	entries, err := afero.ReadDir(f.fs, f.dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		data, err := afero.ReadFile(f.fs, filepath.Join(f.dir, name))
+		if err != nil {
+			continue
+		}
+		var record SessionRecord
+		if json.Unmarshal(data, &record) == nil && record.expired(now) {
+			if err := f.fs.Remove(filepath.Join(f.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package coco
+
+import (
+	coreContext "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Iterator produces values for JSONStream and NDJSON by calling yield for
+// each one, stopping early when yield returns false.
+type Iterator func(yield func(v interface{}) bool)
+
+var errStreamSource = errors.New("stream source must be a channel or an Iterator")
+
+// streamEach calls fn for every value produced by src, which may be a
+// receive-capable channel of any element type or an Iterator. It stops when
+// the source is exhausted, fn returns false or ctx is done, returning
+// ctx.Err() in the latter case.
+func streamEach(ctx coreContext.Context, src interface{}, fn func(v interface{}) bool) error {
+	var iterate Iterator
+	switch s := src.(type) {
+	case Iterator:
+		iterate = s
+	case func(yield func(v interface{}) bool):
+		iterate = s
+	}
+
+	if iterate != nil {
+		iterate(func(v interface{}) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			return fn(v)
+		})
+		return ctx.Err()
+	}
+
+	ch := reflect.ValueOf(src)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return errStreamSource
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: ch},
+	}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if !fn(v.Interface()) {
+			return nil
+		}
+	}
+}
+
+// streamContext returns the context that ends when the client goes away.
+func (r *Response) streamContext() coreContext.Context {
+	if req := r.request(); req != nil {
+		return req.Context()
+	}
+	return coreContext.Background()
+}
+
+// JSONStream writes the values produced by src as a JSON array, encoding and
+// flushing one element at a time instead of marshalling everything up front.
+// src is a channel or an Iterator. Streaming stops when the client
+// disconnects. An encoding error before anything is written produces a 500
+// response; after that the array is left unterminated, so clients see an
+// invalid document rather than a silently truncated one. The error is
+// returned either way.
+func (r *Response) JSONStream(src interface{}) error {
+	settings := r.request().jsonSettings()
+	settings.indent = ""
+
+	r.Set("Content-Type", "application/json; charset=utf-8")
+
+	started := false
+	var encodeErr, writeErr error
+	err := streamEach(r.streamContext(), src, func(v interface{}) bool {
+		b, err := settings.marshal(v)
+		if err != nil {
+			encodeErr = err
+			return false
+		}
+
+		prefix := ","
+		if !started {
+			prefix = "["
+			started = true
+		}
+		if _, writeErr = r.ww.Write(append([]byte(prefix), b...)); writeErr != nil {
+			return false
+		}
+		r.ww.Flush()
+		return true
+	})
+
+	switch {
+	case encodeErr != nil:
+		if !started {
+			http.Error(r.ww, encodeErr.Error(), http.StatusInternalServerError)
+		}
+		return fmt.Errorf("json stream: %w", encodeErr)
+	case writeErr != nil:
+		return writeErr
+	case err != nil:
+		return err
+	}
+
+	closing := "]"
+	if !started {
+		closing = "[]"
+	}
+	if _, err := r.ww.Write([]byte(closing)); err != nil {
+		return err
+	}
+	r.ww.Flush()
+	return nil
+}
+
+// NDJSON writes the values produced by src as newline-delimited JSON,
+// flushing after every line. src is a channel or an Iterator. Streaming stops
+// when the client disconnects. An encoding error before anything is written
+// produces a 500 response; after that a final {"error": "..."} line is
+// written, since a truncated NDJSON stream is otherwise indistinguishable
+// from a complete one. The error is returned either way.
+func (r *Response) NDJSON(src interface{}) error {
+	settings := r.request().jsonSettings()
+	settings.indent = ""
+
+	r.Set("Content-Type", "application/x-ndjson")
+
+	started := false
+	var encodeErr, writeErr error
+	err := streamEach(r.streamContext(), src, func(v interface{}) bool {
+		b, err := settings.marshal(v)
+		if err != nil {
+			encodeErr = err
+			return false
+		}
+
+		started = true
+		if _, writeErr = r.ww.Write(append(b, '\n')); writeErr != nil {
+			return false
+		}
+		r.ww.Flush()
+		return true
+	})
+
+	switch {
+	case encodeErr != nil:
+		if !started {
+			http.Error(r.ww, encodeErr.Error(), http.StatusInternalServerError)
+		} else if line, err := settings.marshal(map[string]string{"error": encodeErr.Error()}); err == nil {
+			_, _ = r.ww.Write(append(line, '\n'))
+			r.ww.Flush()
+		}
+		return fmt.Errorf("ndjson stream: %w", encodeErr)
+	case writeErr != nil:
+		return writeErr
+	case err != nil:
+		return err
+	}
+
+	if !started {
+		r.ww.WriteHeader(r.statusOrOK())
+	}
+	return nil
+}
+
+// statusOrOK returns the status set on the response, defaulting to 200.
+func (r *Response) statusOrOK() int {
+	if code := r.ww._statusCode(); code != 0 {
+		return code
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,131 @@
+package coco_test
+
+import (
+	coreContext "context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+func TestResponseJSONStream(t *testing.T) {
+	app := coco.NewApp()
+
+	var streamErr error
+	app.Get("/channel", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		ch := make(chan map[string]int)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 3; i++ {
+				ch <- map[string]int{"n": i}
+			}
+		}()
+		streamErr = res.JSONStream(ch)
+	})
+	app.Get("/iterator", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		streamErr = res.JSONStream(coco.Iterator(func(yield func(v interface{}) bool) {
+			for _, s := range []string{"a", "b"} {
+				if !yield(s) {
+					return
+				}
+			}
+		}))
+	})
+	app.Get("/empty", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		ch := make(chan int)
+		close(ch)
+		streamErr = res.JSONStream(ch)
+	})
+	app.Get("/bad-first", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		streamErr = res.JSONStream(coco.Iterator(func(yield func(v interface{}) bool) {
+			yield(func() {})
+		}))
+	})
+	app.Get("/bad-later", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		streamErr = res.JSONStream(coco.Iterator(func(yield func(v interface{}) bool) {
+			_ = yield(1) && yield(func() {}) && yield(3)
+		}))
+	})
+
+	tests := []struct {
+		path    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"/channel", http.StatusOK, `[{"n":1},{"n":2},{"n":3}]`, false},
+		{"/iterator", http.StatusOK, `["a","b"]`, false},
+		{"/empty", http.StatusOK, `[]`, false},
+		{"/bad-first", http.StatusInternalServerError, "json: unsupported type: func()\n", true},
+		{"/bad-later", http.StatusOK, `[1`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.body, w.Body.String())
+			assert.Equal(t, tc.wantErr, streamErr != nil, "unexpected error: %v", streamErr)
+		})
+	}
+}
+
+func TestResponseNDJSON(t *testing.T) {
+	app := coco.NewApp()
+
+	var streamErr error
+	app.Get("/ndjson", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		streamErr = res.NDJSON([]int{1, 2})
+	})
+	app.Get("/ndjson-iterator", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		streamErr = res.NDJSON(coco.Iterator(func(yield func(v interface{}) bool) {
+			_ = yield(map[string]int{"n": 1}) && yield(make(chan int))
+		}))
+	})
+
+	t.Run("it should reject unsupported sources", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/ndjson", nil))
+		assert.Error(t, streamErr)
+	})
+
+	t.Run("it should write one value per line and report errors", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/ndjson-iterator", nil))
+
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		assert.Equal(t, "{\"n\":1}\n{\"error\":\"json: unsupported type: chan int\"}\n", w.Body.String())
+		assert.Error(t, streamErr)
+	})
+}
+
+func TestResponseJSONStream_Disconnect(t *testing.T) {
+	app := coco.NewApp()
+
+	ctx, cancel := coreContext.WithCancel(coreContext.Background())
+	done := make(chan error, 1)
+	app.Get("/forever", func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		done <- res.NDJSON(coco.Iterator(func(yield func(v interface{}) bool) {
+			for i := 0; ; i++ {
+				if i == 5 {
+					cancel()
+				}
+				if !yield(i) {
+					return
+				}
+			}
+		}))
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/forever", nil).WithContext(ctx))
+
+	err := <-done
+	assert.True(t, errors.Is(err, coreContext.Canceled), "expected context.Canceled, got %v", err)
+	assert.Equal(t, "0\n1\n2\n3\n4\n", w.Body.String())
+}
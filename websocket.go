@@ -0,0 +1,715 @@
+package coco
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	websocketGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWebSocketReadLimit = 32 << 20
+	websocketCloseTimeout     = 5 * time.Second
+)
+
+// MessageType is the type of a WebSocket data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// WebSocket close codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// ErrWebSocketClosed is returned when writing to a WebSocket after it has
+// been closed.
+var ErrWebSocketClosed = errors.New("websocket: connection closed")
+
+// CloseError reports a closed WebSocket connection: the close frame sent by
+// the peer, or the one sent by coco after a protocol violation.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Reason)
+}
+
+// WebSocketOptions configures WebSocket upgrades.
+type WebSocketOptions struct {
+	// Subprotocols lists the supported subprotocols. The first one the
+	// client offers is selected.
+	Subprotocols []string
+
+	// CheckOrigin reports whether the request’s Origin is allowed. By
+	// default, requests with an Origin header must match the Host.
+	CheckOrigin func(req *Request) bool
+
+	// Compression enables permessage-deflate when the client offers it.
+	Compression bool
+
+	// ReadLimit is the maximum size of a received message, after
+	// decompression. Defaults to 32MB.
+	ReadLimit int64
+
+	// FragmentSize splits sent messages into frames of at most this many
+	// bytes. Zero sends every message as a single frame.
+	FragmentSize int
+
+	// PingInterval sends a ping at this interval and closes the connection
+	// if nothing is received for twice as long. Zero disables pings.
+	PingInterval time.Duration
+}
+
+// WebSocketHandler handles an upgraded WebSocket connection. req is the
+// request that was upgraded, with its params, query and cookies. The
+// connection is closed when the handler returns.
+type WebSocketHandler func(ws *WebSocket, req *Request)
+
+// WebSocket is an upgraded RFC 6455 connection. Reads must come from one
+// goroutine at a time; writes are safe for concurrent use.
+type WebSocket struct {
+	// Subprotocol is the negotiated subprotocol, if any.
+	Subprotocol string
+
+	conn     net.Conn
+	br       *bufio.Reader
+	options  WebSocketOptions
+	compress bool
+
+	writeMu   sync.Mutex
+	closeSent bool
+	closeOnce sync.Once
+	done      chan struct{}
+
+	pongHandler func(data []byte)
+}
+
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// WebSocket registers a GET route that upgrades to a WebSocket and calls
+// handler. The router’s middleware runs before the upgrade, so it can
+// authenticate or reject the request as usual.
+func (r *route) WebSocket(path string, handler WebSocketHandler) *route {
+	return r.Get(path, WebSocketUpgrade(nil, handler))
+}
+
+// WebSocketUpgrade returns a Handler that performs the WebSocket handshake
+// with the given options, nil for the defaults, and calls handler. Use it
+// instead of route.WebSocket to configure the upgrade.
+func WebSocketUpgrade(options *WebSocketOptions, handler WebSocketHandler) Handler {
+	if options == nil {
+		options = &WebSocketOptions{}
+	}
+	return func(res Response, req *Request, next NextFunc) {
+		ws, err := upgradeWebSocket(&res, req, *options)
+		if err != nil {
+			var e Error
+			if errors.As(err, &e) {
+				if e.Code == http.StatusUpgradeRequired {
+					res.Set("Sec-WebSocket-Version", "13")
+				}
+				res.Status(e.Code).Send(e.Message)
+			}
+			return
+		}
+
+		defer ws.Close(CloseNormalClosure, "")
+		handler(ws, req)
+	}
+}
+
+func upgradeWebSocket(res *Response, req *Request, options WebSocketOptions) (*WebSocket, error) {
+	if req.r.Method != http.MethodGet {
+		return nil, Error{http.StatusMethodNotAllowed, "WebSocket upgrade requires GET"}
+	}
+	if !headerHasToken(req.r.Header, "Connection", "upgrade") || !headerHasToken(req.r.Header, "Upgrade", "websocket") {
+		return nil, Error{http.StatusBadRequest, "Missing WebSocket upgrade headers"}
+	}
+	if req.Get("Sec-WebSocket-Version") != "13" {
+		return nil, Error{http.StatusUpgradeRequired, "Unsupported WebSocket version"}
+	}
+	key := req.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, Error{http.StatusBadRequest, "Invalid Sec-WebSocket-Key"}
+	}
+
+	checkOrigin := options.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, Error{http.StatusForbidden, "Origin not allowed"}
+	}
+
+	ws := &WebSocket{options: options, done: make(chan struct{})}
+	if ws.options.ReadLimit <= 0 {
+		ws.options.ReadLimit = defaultWebSocketReadLimit
+	}
+	ws.Subprotocol = selectSubprotocol(req.r.Header, options.Subprotocols)
+	ws.compress = options.Compression && acceptsPerMessageDeflate(req.r.Header)
+
+	conn, brw, err := res.ww.Hijack()
+	if err != nil {
+		return nil, Error{http.StatusInternalServerError, "WebSocket upgrade not supported: " + err.Error()}
+	}
+	ws.conn, ws.br = conn, brw.Reader
+	res.ww.statusCode = http.StatusSwitchingProtocols
+	res.ww.statusCodeWritten = true
+
+	h := res.ww.Header().Clone()
+	for _, k := range []string{"Content-Type", "Content-Length", "Transfer-Encoding"} {
+		h.Del(k)
+	}
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	h.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	if ws.Subprotocol != "" {
+		h.Set("Sec-WebSocket-Protocol", ws.Subprotocol)
+	}
+	if ws.compress {
+		h.Set("Sec-WebSocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if options.PingInterval > 0 {
+		go ws.pingLoop()
+	}
+	return ws, nil
+}
+
+// headerHasToken reports whether the comma-separated header contains token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(req *Request) bool {
+	origin := req.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.r.Host)
+}
+
+func selectSubprotocol(h http.Header, supported []string) string {
+	for _, v := range h.Values("Sec-WebSocket-Protocol") {
+		for _, offered := range strings.Split(v, ",") {
+			offered = strings.TrimSpace(offered)
+			for _, s := range supported {
+				if s == offered {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// acceptsPerMessageDeflate reports whether the client offered
+// permessage-deflate with parameters coco can honour. Contexts are never
+// taken over, so each message is compressed independently.
+func acceptsPerMessageDeflate(h http.Header) bool {
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+	offers:
+		for _, offer := range splitHeader(v) {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			for _, p := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+				switch strings.TrimSpace(name) {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					if strings.Trim(strings.TrimSpace(value), `"`) != "15" {
+						continue offers
+					}
+				default:
+					continue offers
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// OnPong sets a function called with the payload of every pong received.
+func (ws *WebSocket) OnPong(fn func(data []byte)) {
+	ws.pongHandler = fn
+}
+
+// LocalAddr returns the local network address.
+func (ws *WebSocket) LocalAddr() net.Addr {
+	return ws.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (ws *WebSocket) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for future reads.
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes.
+func (ws *WebSocket) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage reads the next data message, reassembling fragments and
+// decompressing it if needed. Pings are answered automatically. When the
+// peer closes the connection, or breaks the protocol, the close handshake
+// is completed and a *CloseError is returned.
+func (ws *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	var (
+		msgType    MessageType
+		message    []byte
+		compressed bool
+		started    bool
+	)
+
+	for {
+		if ws.options.PingInterval > 0 {
+			ws.conn.SetReadDeadline(time.Now().Add(2 * ws.options.PingInterval))
+		}
+		f, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, f.payload, false); err != nil && !errors.Is(err, ErrWebSocketClosed) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if ws.pongHandler != nil {
+				ws.pongHandler(f.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, ws.handleClose(f.payload)
+		case opContinuation:
+			if !started {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case opText, opBinary:
+			if started {
+				return 0, nil, ws.fail(CloseProtocolError, "expected continuation frame")
+			}
+			started = true
+			msgType = MessageType(f.opcode)
+			compressed = f.rsv1
+		default:
+			return 0, nil, ws.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+		}
+
+		if int64(len(message)+len(f.payload)) > ws.options.ReadLimit {
+			return 0, nil, ws.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, f.payload...)
+		if f.fin {
+			break
+		}
+	}
+
+	if compressed {
+		inflated, err := ws.inflate(message)
+		if err != nil {
+			return 0, nil, err
+		}
+		message = inflated
+	}
+	if msgType == TextMessage && !utf8.Valid(message) {
+		return 0, nil, ws.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+	}
+	return msgType, message, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (ws *WebSocket) readFrame() (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.br, header[:]); err != nil {
+		return wsFrame{}, ws.abort(err)
+	}
+
+	f := wsFrame{
+		fin:    header[0]&0x80 != 0,
+		rsv1:   header[0]&0x40 != 0,
+		opcode: header[0] & 0x0f,
+	}
+	if header[0]&0x30 != 0 {
+		return f, ws.fail(CloseProtocolError, "reserved bits set")
+	}
+	if f.rsv1 && (!ws.compress || (f.opcode != opText && f.opcode != opBinary)) {
+		return f, ws.fail(CloseProtocolError, "unexpected RSV1 bit")
+	}
+	if header[1]&0x80 == 0 {
+		return f, ws.fail(CloseProtocolError, "client frames must be masked")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return f, ws.abort(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return f, ws.abort(err)
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return f, ws.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if f.opcode >= opClose && (!f.fin || length > 125) {
+		return f, ws.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > uint64(ws.options.ReadLimit) {
+		return f, ws.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return f, ws.abort(err)
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.br, f.payload); err != nil {
+		return f, ws.abort(err)
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// deflateTail ends a permessage-deflate payload: the stripped sync flush
+// marker followed by an empty final block, so the reader sees io.EOF.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+func (ws *WebSocket) inflate(data []byte) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)))
+	defer fr.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(fr, ws.options.ReadLimit+1))
+	if err != nil {
+		return nil, ws.fail(CloseProtocolError, "invalid compressed message")
+	}
+	if int64(len(inflated)) > ws.options.ReadLimit {
+		return nil, ws.fail(CloseMessageTooBig, "message too big")
+	}
+	return inflated, nil
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]), nil
+}
+
+// handleClose answers the peer’s close frame and closes the connection.
+func (ws *WebSocket) handleClose(payload []byte) error {
+	code, reason := CloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return ws.fail(CloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !validCloseCode(code) {
+			return ws.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(reason) {
+			return ws.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason")
+		}
+	}
+
+	reply := code
+	if code == CloseNoStatusReceived {
+		reply = CloseNormalClosure
+	}
+	ws.sendClose(reply, "")
+	ws.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail closes the connection with code after a protocol violation.
+func (ws *WebSocket) fail(code int, reason string) error {
+	ws.sendClose(code, reason)
+	ws.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// abort closes the connection after a read error, reporting an abnormal
+// closure when the peer went away without a close frame.
+func (ws *WebSocket) abort(err error) error {
+	ws.closeConn()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormalClosure, Reason: "unexpected EOF"}
+	}
+	return err
+}
+
+// WriteMessage sends a data message.
+func (ws *WebSocket) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+
+	compressed := false
+	if ws.compress {
+		deflated, err := deflate(data)
+		if err != nil {
+			return err
+		}
+		data, compressed = deflated, true
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	opcode := byte(messageType)
+	size := ws.options.FragmentSize
+	for first := true; ; first = false {
+		chunk := data
+		if size > 0 && len(chunk) > size {
+			chunk = data[:size]
+		}
+		data = data[len(chunk):]
+
+		op := byte(opContinuation)
+		if first {
+			op = opcode
+		}
+		if err := ws.writeRaw(op, chunk, len(data) == 0, first && compressed); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// WriteText sends a text message.
+func (ws *WebSocket) WriteText(text string) error {
+	return ws.WriteMessage(TextMessage, []byte(text))
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, data)
+}
+
+// Ping sends a ping with an optional payload of up to 125 bytes.
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("websocket: ping payload too long")
+	}
+	return ws.writeFrame(opPing, data, false)
+}
+
+// Close sends a close frame with code and reason and closes the connection.
+// It is safe to call more than once.
+func (ws *WebSocket) Close(code int, reason string) error {
+	if len(reason) > 123 {
+		return errors.New("websocket: close reason too long")
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(websocketCloseTimeout))
+	err := ws.sendClose(code, reason)
+	ws.closeConn()
+	if errors.Is(err, ErrWebSocketClosed) {
+		return nil
+	}
+	return err
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (ws *WebSocket) Done() <-chan struct{} {
+	return ws.done
+}
+
+func (ws *WebSocket) sendClose(code int, reason string) error {
+	var payload []byte
+	if code != CloseNoStatusReceived {
+		payload = make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+	}
+	return ws.writeFrame(opClose, payload, false)
+}
+
+func (ws *WebSocket) closeConn() {
+	ws.closeOnce.Do(func() {
+		ws.writeMu.Lock()
+		ws.closeSent = true
+		ws.writeMu.Unlock()
+		close(ws.done)
+		ws.conn.Close()
+	})
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte, rsv1 bool) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	err := ws.writeRaw(opcode, payload, true, rsv1)
+	if opcode == opClose {
+		ws.closeSent = true
+	}
+	return err
+}
+
+// writeRaw writes a single unmasked frame. ws.writeMu is held.
+func (ws *WebSocket) writeRaw(opcode byte, payload []byte, fin, rsv1 bool) error {
+	header := make([]byte, 10)
+	header[0] = opcode
+	if fin {
+		header[0] |= 0x80
+	}
+	if rsv1 {
+		header[0] |= 0x40
+	}
+
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+		header = header[:2]
+	case n <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+		header = header[:4]
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	_, err := ws.conn.Write(append(header, payload...))
+	return err
+}
+
+func (ws *WebSocket) pingLoop() {
+	ticker := time.NewTicker(ws.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			if err := ws.Ping(nil); err != nil {
+				return
+			}
+		}
+	}
+}
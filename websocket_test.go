@@ -0,0 +1,261 @@
+package coco_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tobolabs/coco/v2"
+)
+
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	resp *http.Response
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string, headers map[string]string) *wsTestClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest("GET", srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsTestClient{t: t, conn: conn, br: br, resp: resp}
+}
+
+func (c *wsTestClient) writeFrame(b0 byte, payload []byte) {
+	c.t.Helper()
+
+	frame := []byte{b0, 0x80}
+	switch {
+	case len(payload) <= 125:
+		frame[1] |= byte(len(payload))
+	default:
+		frame[1] |= 126
+		frame = append(frame, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsTestClient) readFrame() (byte, []byte) {
+	c.t.Helper()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		c.t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(c.br, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0], payload
+}
+
+func closePayload(code int, reason string) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(code))
+	return append(b, reason...)
+}
+
+func TestRouteWebSocket(t *testing.T) {
+	app := coco.NewApp()
+
+	app.Use(func(res coco.Response, req *coco.Request, next coco.NextFunc) {
+		if req.Query["token"] != "secret" {
+			res.SendStatus(http.StatusUnauthorized)
+			return
+		}
+		next(res, req)
+	})
+
+	closed := make(chan error, 1)
+	app.WebSocket("/echo/:room", func(ws *coco.WebSocket, req *coco.Request) {
+		ws.WriteText("joined " + req.Params["room"])
+		for {
+			mt, msg, err := ws.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			ws.WriteMessage(mt, msg)
+		}
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	t.Run("it should run middleware before the upgrade", func(t *testing.T) {
+		c := dialWebSocket(t, srv, "/echo/lobby", nil)
+		assert.Equal(t, http.StatusUnauthorized, c.resp.StatusCode)
+	})
+
+	t.Run("it should require a supported version", func(t *testing.T) {
+		c := dialWebSocket(t, srv, "/echo/lobby?token=secret", map[string]string{"Sec-WebSocket-Version": "8"})
+		assert.Equal(t, http.StatusUpgradeRequired, c.resp.StatusCode)
+		assert.Equal(t, "13", c.resp.Header.Get("Sec-WebSocket-Version"))
+	})
+
+	t.Run("it should reject cross-origin requests", func(t *testing.T) {
+		c := dialWebSocket(t, srv, "/echo/lobby?token=secret", map[string]string{"Origin": "http://evil.example"})
+		assert.Equal(t, http.StatusForbidden, c.resp.StatusCode)
+	})
+
+	t.Run("it should echo messages and answer pings", func(t *testing.T) {
+		c := dialWebSocket(t, srv, "/echo/lobby?token=secret", nil)
+		assert.Equal(t, http.StatusSwitchingProtocols, c.resp.StatusCode)
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", c.resp.Header.Get("Sec-WebSocket-Accept"))
+
+		op, msg := c.readFrame()
+		assert.Equal(t, byte(0x81), op)
+		assert.Equal(t, "joined lobby", string(msg))
+
+		c.writeFrame(0x89, []byte("hi"))
+		op, msg = c.readFrame()
+		assert.Equal(t, byte(0x8a), op)
+		assert.Equal(t, "hi", string(msg))
+
+		// A fragmented message with a ping in between.
+		c.writeFrame(0x01, []byte("hel"))
+		c.writeFrame(0x89, nil)
+		c.writeFrame(0x80, []byte("lo"))
+		op, _ = c.readFrame()
+		assert.Equal(t, byte(0x8a), op)
+		op, msg = c.readFrame()
+		assert.Equal(t, byte(0x81), op)
+		assert.Equal(t, "hello", string(msg))
+
+		big := bytes.Repeat([]byte("x"), 300)
+		c.writeFrame(0x82, big)
+		op, msg = c.readFrame()
+		assert.Equal(t, byte(0x82), op)
+		assert.Equal(t, big, msg)
+
+		c.writeFrame(0x88, closePayload(coco.CloseGoingAway, "bye"))
+		op, msg = c.readFrame()
+		assert.Equal(t, byte(0x88), op)
+		assert.Equal(t, closePayload(coco.CloseGoingAway, ""), msg)
+
+		err := <-closed
+		if assert.IsType(t, &coco.CloseError{}, err) {
+			assert.Equal(t, coco.CloseGoingAway, err.(*coco.CloseError).Code)
+			assert.Equal(t, "bye", err.(*coco.CloseError).Reason)
+		}
+	})
+
+	t.Run("it should close on protocol errors", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			b0    byte
+			frame []byte
+			code  int
+		}{
+			{"unexpected continuation", 0x80, []byte("x"), coco.CloseProtocolError},
+			{"invalid utf-8", 0x81, []byte{0xff, 0xfe}, coco.CloseInvalidFramePayloadData},
+			{"reserved bits", 0xc1, []byte("x"), coco.CloseProtocolError},
+			{"unknown opcode", 0x83, nil, coco.CloseProtocolError},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				c := dialWebSocket(t, srv, "/echo/lobby?token=secret", nil)
+				c.readFrame()
+
+				c.writeFrame(tc.b0, tc.frame)
+				op, msg := c.readFrame()
+				assert.Equal(t, byte(0x88), op)
+				assert.Equal(t, tc.code, int(binary.BigEndian.Uint16(msg)))
+				<-closed
+			})
+		}
+	})
+}
+
+func TestWebSocketUpgrade_Options(t *testing.T) {
+	app := coco.NewApp()
+
+	app.Get("/ws", coco.WebSocketUpgrade(&coco.WebSocketOptions{
+		Subprotocols: []string{"chat.v2", "chat.v1"},
+		Compression:  true,
+		FragmentSize: 4,
+	}, func(ws *coco.WebSocket, req *coco.Request) {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		ws.WriteText(ws.Subprotocol + ": " + string(msg))
+	}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	c := dialWebSocket(t, srv, "/ws", map[string]string{
+		"Sec-WebSocket-Protocol":   "chat.v1, chat.v2",
+		"Sec-WebSocket-Extensions": "permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits",
+	})
+	assert.Equal(t, http.StatusSwitchingProtocols, c.resp.StatusCode)
+	assert.Equal(t, "chat.v1", c.resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "permessage-deflate; server_no_context_takeover; client_no_context_takeover", c.resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	fw.Write([]byte("hello hello hello"))
+	fw.Flush()
+	c.writeFrame(0xc1, bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff}))
+
+	// The compressed reply arrives in 4-byte fragments.
+	var compressed []byte
+	for {
+		op, payload := c.readFrame()
+		compressed = append(compressed, payload...)
+		if op&0x80 != 0 {
+			break
+		}
+	}
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(compressed), bytes.NewReader([]byte{0, 0, 0xff, 0xff, 1, 0, 0, 0xff, 0xff})))
+	msg, err := io.ReadAll(fr)
+	assert.NoError(t, err)
+	assert.Equal(t, "chat.v1: hello hello hello", string(msg))
+}